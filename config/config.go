@@ -1,95 +1,433 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
 	Server           ServerConfig           `mapstructure:"server"`
+	Log              LogConfig              `mapstructure:"log"`
 	Redis            RedisConfig            `mapstructure:"redis"`
 	JWT              JWTConfig              `mapstructure:"jwt"`
 	Cache            CacheConfig            `mapstructure:"cache"`
 	RateLimit        RateLimitConfig        `mapstructure:"rate_limit"`
+	Metrics          MetricsConfig          `mapstructure:"metrics"`
+	Tracing          TracingConfig          `mapstructure:"tracing"`
+	Audit            AuditConfig            `mapstructure:"audit"`
+	Secrets          SecretsConfig          `mapstructure:"secrets"`
+	Admin            AdminConfig            `mapstructure:"admin"`
+	Health           HealthConfig           `mapstructure:"health"`
 	ExternalServices ExternalServicesConfig `mapstructure:"external_services"`
 }
 
 type ServerConfig struct {
-	Port         string   `mapstructure:"port"`
-	Mode         string   `mapstructure:"mode"`
-	TrustedProxy string   `mapstructure:"trusted_proxy"` // CIDR format for trusted proxies
-	AllowOrigins []string `mapstructure:"allow_origins"` // CORS allowed origins
+	Port         string   `mapstructure:"port" validate:"required,port"`
+	Mode         string   `mapstructure:"mode" validate:"oneof=debug release test"`
+	AllowOrigins []string `mapstructure:"allow_origins" validate:"dive,required"` // CORS allowed origins
+
+	// Proxies whose forwarding headers are believed, as CIDR ranges or IP
+	// addresses. The client is the rightmost hop that is not one of them.
+	TrustedProxies []string `mapstructure:"trusted_proxies" validate:"dive,cidr|ip"`
+
+	RequestIDHeader string `mapstructure:"request_id_header" validate:"required"` // Header accepting and returning the request ID
+
+	// Limits on client connections, 0 for none
+	ReadTimeout       time.Duration `mapstructure:"read_timeout" validate:"gte=0"`        // Reading the whole request, body included
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout" validate:"gte=0"` // Reading the request headers
+	WriteTimeout      time.Duration `mapstructure:"write_timeout" validate:"gte=0"`       // From the end of the headers to the end of the response
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout" validate:"gte=0"`        // Keep-alive connections waiting for a request
+	MaxHeaderBytes    int           `mapstructure:"max_header_bytes" validate:"gte=0"`    // Request line and headers, 0 for 1MB
+
+	// Shutdown: readiness fails for the drain period before the listeners
+	// close, then in-flight requests get the shutdown timeout to finish
+	DrainPeriod     time.Duration `mapstructure:"drain_period" validate:"gte=0"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout" validate:"gt=0"`
+
+	TLS   TLSConfig   `mapstructure:"tls"`
+	HSTS  HSTSConfig  `mapstructure:"hsts"`
+	HTTP2 HTTP2Config `mapstructure:"http2"`
+
+	// Listeners replace port and tls when set, serving the gateway on
+	// several addresses
+	Listeners []ListenerConfig `mapstructure:"listeners" validate:"dive"`
+}
+
+// ListenerConfig is an address the gateway is served on
+type ListenerConfig struct {
+	Name          string    `mapstructure:"name" validate:"required"`                           // Identifies the listener in logs
+	Network       string    `mapstructure:"network" validate:"omitempty,oneof=tcp unix"`        // tcp or unix, tcp when empty
+	Address       string    `mapstructure:"address" validate:"required"`                        // host:port, or the socket path of unix listeners
+	SocketMode    string    `mapstructure:"socket_mode"`                                        // Octal permissions of the socket file such as 0660, the umask applies when empty
+	Profile       string    `mapstructure:"profile" validate:"omitempty,oneof=public internal"` // internal skips rate limiting and CORS, public when empty
+	ProxyProtocol bool      `mapstructure:"proxy_protocol"`                                     // Require a PROXY protocol v1 or v2 header on every connection
+	TLS           TLSConfig `mapstructure:"tls"`
+}
+
+// Listener profiles
+const (
+	ProfilePublic   = "public"
+	ProfileInternal = "internal"
+)
+
+// EffectiveListeners returns the configured listeners, or a single public
+// TCP listener on port with the server TLS settings when none are
+func (c *ServerConfig) EffectiveListeners() []ListenerConfig {
+	if len(c.Listeners) > 0 {
+		return c.Listeners
+	}
+	return []ListenerConfig{{
+		Name:    "default",
+		Network: "tcp",
+		Address: ":" + c.Port,
+		Profile: ProfilePublic,
+		TLS:     c.TLS,
+	}}
+}
+
+// HTTP2Config configures HTTP/2 on the server port, negotiated by ALPN over
+// TLS or spoken in cleartext with h2c
+type HTTP2Config struct {
+	Enabled              bool   `mapstructure:"enabled"`
+	H2C                  bool   `mapstructure:"h2c"`                    // Accept cleartext HTTP/2 when TLS is disabled
+	MaxConcurrentStreams uint32 `mapstructure:"max_concurrent_streams"` // Per connection, 0 for the default of 250
+}
+
+// TLSConfig configures HTTPS on the server port or a listener
+type TLSConfig struct {
+	Enabled      bool                `mapstructure:"enabled"`
+	Certificates []CertificateConfig `mapstructure:"certificates" validate:"required_if=Enabled true,dive"` // Selected by SNI, the first one when no name matches
+	MinVersion   string              `mapstructure:"min_version" validate:"omitempty,oneof=1.2 1.3"`        // Empty for 1.2
+	MaxVersion   string              `mapstructure:"max_version" validate:"omitempty,oneof=1.2 1.3"`        // Empty for the newest supported
+	CipherSuites []string            `mapstructure:"cipher_suites"`                                         // TLS 1.2 suites by IANA name, empty for Go's defaults
+	RedirectPort string              `mapstructure:"redirect_port" validate:"omitempty,port"`               // Plain HTTP port redirecting to HTTPS, empty to disable
+}
+
+// CertificateConfig is a PEM certificate chain and its private key, reloaded
+// when either file changes
+type CertificateConfig struct {
+	CertFile string `mapstructure:"cert_file" validate:"required"`
+	KeyFile  string `mapstructure:"key_file" validate:"required"`
+}
+
+// HSTSConfig configures the Strict-Transport-Security header sent on HTTPS
+// responses
+type HSTSConfig struct {
+	Enabled           bool          `mapstructure:"enabled"`
+	MaxAge            time.Duration `mapstructure:"max_age" validate:"gte=0"`
+	IncludeSubdomains bool          `mapstructure:"include_subdomains"`
+	Preload           bool          `mapstructure:"preload"`
+}
+
+type LogConfig struct {
+	Level             string  `mapstructure:"level" validate:"oneof=debug info warn error"` // debug, info, warn or error
+	Format            string  `mapstructure:"format" validate:"oneof=json text"`            // json or text
+	Output            string  `mapstructure:"output" validate:"required"`                   // stdout, stderr or a file path
+	SuccessSampleRate float64 `mapstructure:"success_sample_rate" validate:"gte=0,lte=1"`   // Fraction of successful request logs written
+	MaxSizeMB         int     `mapstructure:"max_size_mb" validate:"gte=0"`                 // Size at which file outputs are rotated, 0 disables rotation
+	MaxBackups        int     `mapstructure:"max_backups" validate:"gte=0"`                 // Rotated files kept, 0 keeps all
+
+	Access AccessLogConfig `mapstructure:"access"`
+}
+
+type AccessLogConfig struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Format  string   `mapstructure:"format" validate:"omitempty,oneof=json common combined"` // json, common or combined
+	Fields  []string `mapstructure:"fields"`                                                 // Fields of json lines, in order
+	Output  string   `mapstructure:"output" validate:"required_if=Enabled true"`             // stdout, stderr or a file path
+	Skip    []string `mapstructure:"skip"`                                                   // Routes or paths not logged, such as /health
 }
 
 type RedisConfig struct {
 	Host string `mapstructure:"host"`
-	Port string `mapstructure:"port"`
-	DB   int    `mapstructure:"db"`
+	Port string `mapstructure:"port" validate:"omitempty,port"`
+	DB   int    `mapstructure:"db" validate:"gte=0"`
+
+	Addrs      []string `mapstructure:"addrs" validate:"dive,hostname_port"` // Cluster or sentinel node addresses, overriding host and port
+	MasterName string   `mapstructure:"master_name"`                         // Sentinel master name, enables failover mode
+
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+
+	TLS           bool   `mapstructure:"tls"`             // Connect over TLS
+	TLSCAFile     string `mapstructure:"tls_ca_file"`     // PEM bundle verifying the server, system roots when empty
+	TLSSkipVerify bool   `mapstructure:"tls_skip_verify"` // Skip server certificate verification
+
+	PoolSize     int           `mapstructure:"pool_size" validate:"gte=0"`      // Connections per node, 0 for the client default
+	MinIdleConns int           `mapstructure:"min_idle_conns" validate:"gte=0"` // Idle connections kept open per node
+	DialTimeout  time.Duration `mapstructure:"dial_timeout" validate:"gte=0"`
+	ReadTimeout  time.Duration `mapstructure:"read_timeout" validate:"gte=0"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout" validate:"gte=0"`
+
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval" validate:"gt=0"` // How often availability is probed
 }
 
 type JWTConfig struct {
-	Secret string `mapstructure:"secret"`
+	Secret string `mapstructure:"secret" validate:"required"`
 }
 
 type CacheConfig struct {
-	Duration int `mapstructure:"duration"` // Default cache duration in seconds
+	Duration int `mapstructure:"duration" validate:"gte=0"`  // Default freshness lifetime in seconds when responses set no max-age
+	StaleTTL int `mapstructure:"stale_ttl" validate:"gte=0"` // Seconds expired entries are kept for revalidation
+
+	StaleWhileRevalidate int `mapstructure:"stale_while_revalidate" validate:"gte=0"` // Default seconds a stale entry is served while refreshing
+	StaleIfError         int `mapstructure:"stale_if_error" validate:"gte=0"`         // Default seconds a stale entry is served when the origin fails
+
+	L1MaxBytes int `mapstructure:"l1_max_bytes" validate:"gte=0"` // Memory budget of the in-process cache, 0 disables it
+	L1TTL      int `mapstructure:"l1_ttl" validate:"gte=0"`       // Seconds an entry is kept in the in-process cache
+
+	Store          string `mapstructure:"store" validate:"oneof=redis memory disk"`    // Entry storage backend: redis, memory or disk
+	DiskPath       string `mapstructure:"disk_path" validate:"required_if=Store disk"` // Directory holding entries of the disk store
+	MemoryMaxBytes int    `mapstructure:"memory_max_bytes" validate:"gte=0"`           // Memory budget of the memory store, 0 for unbounded
+
+	MaxBodyBytes        int `mapstructure:"max_body_bytes" validate:"gte=0"`        // Largest response body cached, 0 for no limit
+	CompressionMinBytes int `mapstructure:"compression_min_bytes" validate:"gte=0"` // Smallest body gzip compressed in the store, 0 disables compression
+
+	Namespace   string             `mapstructure:"namespace"`              // Prefix separating the keys of different gateways
+	KeyVersion  string             `mapstructure:"key_version"`            // Bump to orphan every existing entry
+	IgnoreQuery []string           `mapstructure:"ignore_query"`           // Query parameters left out of every key, a trailing * matches a prefix
+	Routes      []CacheRouteConfig `mapstructure:"routes" validate:"dive"` // Per-route key and lifetime rules
+}
+
+// CacheRouteConfig overrides how responses of a single route are cached
+type CacheRouteConfig struct {
+	Route          string   `mapstructure:"route" validate:"startswith=/"` // Gin route pattern such as /api/users/:id
+	Disabled       bool     `mapstructure:"disabled"`                      // Never store responses of the route
+	TTL            int      `mapstructure:"ttl" validate:"gte=0"`          // Default freshness lifetime in seconds, 0 uses cache.duration
+	QueryInclude   []string `mapstructure:"query_include"`                 // Only these query parameters are part of the key, empty for all
+	QueryIgnore    []string `mapstructure:"query_ignore"`                  // Query parameters left out in addition to cache.ignore_query
+	KeepQueryOrder bool     `mapstructure:"keep_query_order"`              // Do not sort query parameters
+	Headers        []string `mapstructure:"headers"`                       // Request headers added to the key
+	Principal      []string `mapstructure:"principal"`                     // Bearer token claims added to the key, such as tenant or user_id. Authenticated responses are then stored per principal when the token holds every claim
 }
 
 type RateLimitConfig struct {
-	RequestsPerMinute int `mapstructure:"requests_per_minute"` // Number of requests allowed per minute
-	BurstSize         int `mapstructure:"burst_size"`          // Maximum burst size
-	CleanupInterval   int `mapstructure:"cleanup_interval"`    // Cleanup interval in minutes
+	RequestsPerMinute int `mapstructure:"requests_per_minute" validate:"gt=0"` // Number of requests allowed per minute
+	BurstSize         int `mapstructure:"burst_size" validate:"gt=0"`          // Maximum burst size
+	CleanupInterval   int `mapstructure:"cleanup_interval" validate:"gt=0"`    // Cleanup interval in minutes
+}
+
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`                              // Serve Prometheus metrics
+	Path    string `mapstructure:"path" validate:"startswith=/"`         // Route the metrics are served on
+	Listen  string `mapstructure:"listen" validate:"oneof=internal all"` // internal serves them on internal listeners and the admin API only, all on every listener
+}
+
+// Listeners the metrics are served on
+const (
+	MetricsListenInternal = "internal"
+	MetricsListenAll      = "all"
+)
+
+type TracingConfig struct {
+	Enabled     bool              `mapstructure:"enabled"`                                      // Export OpenTelemetry traces
+	ServiceName string            `mapstructure:"service_name" validate:"required"`             // service.name resource attribute
+	Endpoint    string            `mapstructure:"endpoint" validate:"required_if=Enabled true"` // OTLP/HTTP collector host:port
+	URLPath     string            `mapstructure:"url_path"`                                     // OTLP/HTTP traces path, /v1/traces when empty
+	Insecure    bool              `mapstructure:"insecure"`                                     // Export over plain HTTP
+	Headers     map[string]string `mapstructure:"headers"`                                      // Headers sent with every export, such as API keys
+	SampleRatio float64           `mapstructure:"sample_ratio" validate:"gte=0,lte=1"`          // Fraction of new traces sampled, parents' decisions are kept
+}
+
+type AuditConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`                                   // Record state-changing API requests
+	Store        string   `mapstructure:"store" validate:"oneof=file redis"`         // file or redis
+	Path         string   `mapstructure:"path" validate:"required_if=Store file"`    // JSON lines file of the file store
+	Stream       string   `mapstructure:"stream" validate:"required_if=Store redis"` // Stream key of the redis store
+	MaxBodyBytes int64    `mapstructure:"max_body_bytes" validate:"gt=0"`            // Larger request bodies are not recorded
+	Redact       []string `mapstructure:"redact"`                                    // Body fields whose names contain these words are redacted
+}
+
+// HealthConfig configures the dependency checks behind /readyz
+type HealthConfig struct {
+	Timeout  time.Duration `mapstructure:"timeout" validate:"gt=0"`                           // Per check
+	Critical []string      `mapstructure:"critical" validate:"dive,oneof=redis user_service"` // Checks failing readiness, others only degrade it
+	CacheTTL time.Duration `mapstructure:"cache_ttl" validate:"gte=0"`                        // Check results are reused for this long, 0 runs them on every probe
+}
+
+// AdminConfig configures the admin API, served on its own listener
+type AdminConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Port    string `mapstructure:"port" validate:"required_if=Enabled true,omitempty,port"`
+	Token   string `mapstructure:"token" validate:"required_if=Enabled true"` // Bearer token required by every admin request
+}
+
+// SecretsConfig configures how file://, env:// and vault:// references in
+// config values are resolved
+type SecretsConfig struct {
+	RefreshInterval time.Duration `mapstructure:"refresh_interval" validate:"gte=0"` // How often references are resolved again, 0 disables refresh
+	Vault           VaultConfig   `mapstructure:"vault"`
+}
+
+type VaultConfig struct {
+	Address   string        `mapstructure:"address" validate:"omitempty,url"` // Server URL, vault:// references are refused when empty
+	Token     string        `mapstructure:"token"`                            // May itself be a file:// or env:// reference
+	Namespace string        `mapstructure:"namespace"`
+	KVVersion int           `mapstructure:"kv_version" validate:"oneof=1 2"`
+	Timeout   time.Duration `mapstructure:"timeout" validate:"gte=0"`
 }
 
 type ExternalServicesConfig struct {
+	// base_url, timeout, token, transport keys such as protocol, and
+	// breaker_failures and breaker_open_duration configuring the circuit
+	// breaker, 5 consecutive failures and 30s by default
 	UserService map[string]string `mapstructure:"user_service"`
 }
 
-// LoadConfig reads configuration from environment variables or config file
-func LoadConfig() (*Config, error) {
+// removedTrustedProxyKey is the single trusted proxy setting replaced by
+// server.trusted_proxies
+const removedTrustedProxyKey = "server.trusted_proxy"
+
+// LoadConfig reads the configuration from defaults, the YAML, TOML or JSON
+// file at path if not empty, and APP_* environment variables, in increasing
+// order of precedence. Secret references are then resolved and the result
+// is validated.
+func LoadConfig(path string) (*Config, error) {
+	v := viper.New()
+
 	// Server defaults
-	viper.SetDefault("server.port", "8080")
-	viper.SetDefault("server.mode", "debug")
-	viper.SetDefault("server.trusted_proxy", "127.0.0.1/32")
+	v.SetDefault("server.port", "8080")
+	v.SetDefault("server.mode", "debug")
+	v.SetDefault("server.trusted_proxies", []string{"127.0.0.1/32", "::1/128"})
+	v.SetDefault("server.request_id_header", "X-Request-ID")
+	v.SetDefault("server.read_timeout", "30s")
+	v.SetDefault("server.read_header_timeout", "10s")
+	v.SetDefault("server.write_timeout", "60s")
+	v.SetDefault("server.idle_timeout", "120s")
+	v.SetDefault("server.max_header_bytes", 1<<20)
+	v.SetDefault("server.drain_period", "5s")
+	v.SetDefault("server.shutdown_timeout", "10s")
+	v.SetDefault("server.tls.enabled", false)
+	v.SetDefault("server.tls.min_version", "1.2")
+	v.SetDefault("server.tls.max_version", "")
+	v.SetDefault("server.tls.redirect_port", "")
+	v.SetDefault("server.http2.enabled", true)
+	v.SetDefault("server.http2.h2c", false)
+	v.SetDefault("server.http2.max_concurrent_streams", 250)
+	v.SetDefault("server.hsts.enabled", true)
+	v.SetDefault("server.hsts.max_age", "8760h")
+	v.SetDefault("server.hsts.include_subdomains", false)
+	v.SetDefault("server.hsts.preload", false)
 
 	// Default CORS origins - ensure at least one origin is allowed
-	viper.SetDefault("server.allow_origins", []string{
+	v.SetDefault("server.allow_origins", []string{
 		"http://localhost:8080",
 		"http://127.0.0.1:8080",
 	})
 
+	// Log defaults
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.format", "json")
+	v.SetDefault("log.output", "stdout")
+	v.SetDefault("log.success_sample_rate", 1.0)
+	v.SetDefault("log.max_size_mb", 100)
+	v.SetDefault("log.max_backups", 5)
+	v.SetDefault("log.access.enabled", true)
+	v.SetDefault("log.access.format", "json")
+	v.SetDefault("log.access.output", "stdout")
+
 	// Redis defaults
-	viper.SetDefault("redis.host", "gqetIorpvdYUyjDtOYwIzDhaiiQUoEOx@tramway.proxy.rlwy.net")
-	viper.SetDefault("redis.port", "11897")
-	viper.SetDefault("redis.db", 0)
+	// Credentials are configured with redis.username and redis.password,
+	// preferably as file:// or vault:// references
+	v.SetDefault("redis.host", "localhost")
+	v.SetDefault("redis.port", "6379")
+	v.SetDefault("redis.username", "")
+	v.SetDefault("redis.password", "")
+	v.SetDefault("redis.db", 0)
+	v.SetDefault("redis.dial_timeout", "2s")
+	v.SetDefault("redis.read_timeout", "500ms")
+	v.SetDefault("redis.write_timeout", "500ms")
+	v.SetDefault("redis.health_check_interval", "5s")
 
 	// JWT defaults
-	viper.SetDefault("jwt.secret", "your-secret-key")
+	v.SetDefault("jwt.secret", DefaultJWTSecret)
 
 	// Cache defaults
-	viper.SetDefault("cache.duration", 60) // 1 minute
+	v.SetDefault("cache.duration", 60)   // 1 minute
+	v.SetDefault("cache.stale_ttl", 300) // 5 minutes
+	v.SetDefault("cache.stale_while_revalidate", 0)
+	v.SetDefault("cache.stale_if_error", 300)
+	v.SetDefault("cache.l1_max_bytes", 64<<20) // 64 MiB
+	v.SetDefault("cache.l1_ttl", 5)
+	v.SetDefault("cache.store", "redis")
+	v.SetDefault("cache.disk_path", "cache")
+	v.SetDefault("cache.memory_max_bytes", 256<<20) // 256 MiB
+	v.SetDefault("cache.max_body_bytes", 8<<20)     // 8 MiB
+	v.SetDefault("cache.compression_min_bytes", 1024)
+	v.SetDefault("cache.ignore_query", []string{"utm_*", "fbclid", "gclid"})
 
 	// Rate limit defaults
-	viper.SetDefault("rate_limit.requests_per_minute", 100)
-	viper.SetDefault("rate_limit.burst_size", 100)
-	viper.SetDefault("rate_limit.cleanup_interval", 5)
+	v.SetDefault("rate_limit.requests_per_minute", 100)
+	v.SetDefault("rate_limit.burst_size", 100)
+	v.SetDefault("rate_limit.cleanup_interval", 5)
+
+	// Metrics defaults
+	v.SetDefault("metrics.enabled", true)
+	v.SetDefault("metrics.path", "/metrics")
+	v.SetDefault("metrics.listen", "internal")
+
+	// Tracing defaults
+	v.SetDefault("tracing.enabled", false)
+	v.SetDefault("tracing.service_name", "api-gateway")
+	v.SetDefault("tracing.endpoint", "localhost:4318")
+	v.SetDefault("tracing.insecure", true)
+	v.SetDefault("tracing.sample_ratio", 1.0)
+
+	// Audit defaults
+	v.SetDefault("audit.enabled", true)
+	v.SetDefault("audit.store", "file")
+	v.SetDefault("audit.path", "audit.jsonl")
+	v.SetDefault("audit.stream", "{audit}:events")
+	v.SetDefault("audit.max_body_bytes", 64<<10)
+	v.SetDefault("audit.redact", []string{"password", "secret", "token", "authorization", "api_key"})
+
+	// Health check defaults
+	v.SetDefault("health.timeout", "2s")
+	v.SetDefault("health.critical", []string{"user_service"})
+	v.SetDefault("health.cache_ttl", "1s")
+
+	// Admin API defaults
+	v.SetDefault("admin.enabled", false)
+	v.SetDefault("admin.port", "9091")
+	v.SetDefault("admin.token", "")
+
+	// Secrets defaults
+	v.SetDefault("secrets.refresh_interval", "5m")
+	v.SetDefault("secrets.vault.kv_version", 2)
+	v.SetDefault("secrets.vault.timeout", "5s")
 
 	// External Services defaults
-	viper.SetDefault("external_services.user_service", map[string]string{
+	v.SetDefault("external_services.user_service", map[string]string{
 		"base_url": "http://localhost:8081",
-		"timeout":  "30s",
+		"timeout":  "10s",
 	})
 
 	// Enable environment variable binding
-	viper.AutomaticEnv()
-	viper.SetEnvPrefix("APP")
+	v.AutomaticEnv()
+	v.SetEnvPrefix("APP")
 
 	// Replace dots with underscores in env variables
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	bindEnv(v, reflect.TypeOf(Config{}), "")
+	v.BindEnv(removedTrustedProxyKey)
+
+	if path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
 
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	if err := resolveSecrets(&config); err != nil {
 		return nil, err
 	}
 
@@ -98,5 +436,44 @@ func LoadConfig() (*Config, error) {
 		config.Server.AllowOrigins = []string{"http://localhost:8080"}
 	}
 
+	// The replaced single proxy setting is refused rather than ignored, as
+	// ignoring it would trust the default proxies only
+	var problems []string
+	if v.IsSet(removedTrustedProxyKey) {
+		problems = append(problems, removedTrustedProxyKey+": replaced by server.trusted_proxies, a list of CIDR ranges or IP addresses")
+	}
+	if err := config.Validate(); err != nil {
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			return nil, err
+		}
+		problems = append(problems, verr.Problems...)
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
 	return &config, nil
 }
+
+// bindEnv binds the APP_* variable of every key of the struct type t, as
+// AutomaticEnv only applies to keys viper knows from defaults or the file.
+// Maps and lists of structs cannot be set by a single variable and are left
+// out.
+func bindEnv(v *viper.Viper, t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+
+		switch ft := field.Type; {
+		case ft.Kind() == reflect.Struct:
+			bindEnv(v, ft, key+".")
+		case ft.Kind() == reflect.Map, ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+		default:
+			v.BindEnv(key)
+		}
+	}
+}
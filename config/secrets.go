@@ -0,0 +1,35 @@
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"api-gateway/internal/secrets"
+)
+
+// resolveSecrets replaces file://, env:// and vault:// references in every
+// config value with the secrets they point to. The Vault settings are
+// resolved first, without vault:// references, so the token can be read
+// from a file.
+func resolveSecrets(cfg *Config) error {
+	ctx := context.Background()
+	resolver := secrets.NewResolver()
+	if err := resolver.ResolveStruct(ctx, &cfg.Secrets); err != nil {
+		return fmt.Errorf("failed to resolve secrets:\n%w", err)
+	}
+
+	// Each Vault request is bounded by the configured timeout
+	if vault := cfg.Secrets.Vault; vault.Address != "" {
+		resolver.Register("vault", secrets.NewVault(secrets.VaultOptions{
+			Address:   vault.Address,
+			Token:     vault.Token,
+			Namespace: vault.Namespace,
+			KVVersion: vault.KVVersion,
+			Timeout:   vault.Timeout,
+		}))
+	}
+	if err := resolver.ResolveStruct(ctx, cfg); err != nil {
+		return fmt.Errorf("failed to resolve secrets:\n%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// DefaultJWTSecret is the placeholder JWT secret, refused in release mode
+const DefaultJWTSecret = "your-secret-key"
+
+// minReleaseJWTSecretLength is the shortest JWT secret accepted in release mode
+const minReleaseJWTSecretLength = 32
+
+// minReleaseAdminTokenLength is the shortest admin token accepted in release mode
+const minReleaseAdminTokenLength = 32
+
+// upstreamProtocols are the protocols upstream services can be reached with
+var upstreamProtocols = []string{"auto", "http1", "http2", "h2c"}
+
+var validate = newValidator()
+
+// newValidator creates a validator naming fields by their config keys
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		return name
+	})
+	// The baked-in port rule only accepts integer fields
+	v.RegisterValidation("port", func(fl validator.FieldLevel) bool {
+		port, err := strconv.Atoi(fl.Field().String())
+		return err == nil && port > 0 && port <= 65535
+	})
+	return v
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the configuration, reporting every problem at once. In
+// release mode insecure settings such as the placeholder JWT secret are
+// refused as well.
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(key, format string, args ...any) {
+		problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+	}
+
+	if err := validate.Struct(c); err != nil {
+		var fieldErrs validator.ValidationErrors
+		if !errors.As(err, &fieldErrs) {
+			return err
+		}
+		for _, fe := range fieldErrs {
+			// Drop the leading "Config."
+			_, key, _ := strings.Cut(fe.Namespace(), ".")
+			add(key, "%s", describe(fe))
+		}
+	}
+
+	if svc := c.ExternalServices.UserService; svc != nil {
+		if u, err := url.Parse(svc["base_url"]); err != nil || u.Scheme == "" || u.Host == "" {
+			add("external_services.user_service.base_url", "must be an absolute URL")
+		}
+		for _, key := range []string{"timeout", "idle_conn_timeout", "breaker_open_duration"} {
+			if _, err := time.ParseDuration(svc[key]); svc[key] != "" && err != nil {
+				add("external_services.user_service."+key, "must be a duration such as 30s")
+			}
+		}
+		for _, key := range []string{"max_idle_conns", "max_conns_per_host", "breaker_failures"} {
+			if n, err := strconv.Atoi(svc[key]); svc[key] != "" && (err != nil || n < 0) {
+				add("external_services.user_service."+key, "must be a non-negative integer")
+			}
+		}
+		if p := svc["protocol"]; p != "" && !slices.Contains(upstreamProtocols, p) {
+			add("external_services.user_service.protocol", "must be one of %s, got %q", strings.Join(upstreamProtocols, ", "), p)
+		}
+	}
+
+	if c.Server.TLS.Enabled {
+		validateTLS(add, "server.tls", &c.Server.TLS)
+		if c.Server.TLS.RedirectPort == c.Server.Port {
+			add("server.tls.redirect_port", "must differ from server.port")
+		}
+		if len(c.Server.Listeners) > 0 {
+			add("server.tls.enabled", "TLS is configured per listener when server.listeners are set")
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, l := range c.Server.Listeners {
+		key := fmt.Sprintf("server.listeners[%d]", i)
+		if names[l.Name] {
+			add(key+".name", "duplicate listener name %q", l.Name)
+		}
+		names[l.Name] = true
+		if l.Network == "unix" {
+			if mode, err := strconv.ParseUint(l.SocketMode, 8, 32); l.SocketMode != "" && (err != nil || mode > 0o777) {
+				add(key+".socket_mode", "must be octal permissions such as 0660, got %q", l.SocketMode)
+			}
+		} else {
+			if _, port, err := net.SplitHostPort(l.Address); l.Address != "" && err != nil {
+				add(key+".address", "must be a host:port address, got %q", l.Address)
+			} else if c.Admin.Enabled && port == c.Admin.Port {
+				add("admin.port", "must differ from the port of %s", key)
+			}
+			if l.SocketMode != "" {
+				add(key+".socket_mode", "only applies to unix listeners")
+			}
+		}
+		if l.TLS.Enabled {
+			validateTLS(add, key+".tls", &l.TLS)
+		}
+		if l.TLS.RedirectPort != "" {
+			add(key+".tls.redirect_port", "redirecting to HTTPS is only supported by server.tls")
+		}
+	}
+
+	// Listeners replace server.port, their ports are checked above
+	if c.Admin.Enabled && len(c.Server.Listeners) == 0 {
+		if c.Admin.Port == c.Server.Port {
+			add("admin.port", "must differ from server.port")
+		}
+		if c.Server.TLS.Enabled && c.Admin.Port == c.Server.TLS.RedirectPort {
+			add("admin.port", "must differ from server.tls.redirect_port")
+		}
+	}
+
+	if c.Server.Mode == "release" {
+		if c.JWT.Secret == DefaultJWTSecret {
+			add("jwt.secret", "the placeholder secret is not allowed in release mode")
+		} else if len(c.JWT.Secret) < minReleaseJWTSecretLength {
+			add("jwt.secret", "must be at least %d bytes in release mode", minReleaseJWTSecretLength)
+		}
+		if slices.Contains(c.Server.AllowOrigins, "*") {
+			add("server.allow_origins", "a wildcard origin is not allowed in release mode")
+		}
+		if c.Admin.Enabled && c.Admin.Token != "" && len(c.Admin.Token) < minReleaseAdminTokenLength {
+			add("admin.token", "must be at least %d bytes in release mode", minReleaseAdminTokenLength)
+		}
+		if c.Redis.TLSSkipVerify {
+			add("redis.tls_skip_verify", "certificate verification cannot be disabled in release mode")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// validateTLS checks the TLS settings under key that the struct tags cannot
+func validateTLS(add func(key, format string, args ...any), key string, tlsCfg *TLSConfig) {
+	for i, name := range tlsCfg.CipherSuites {
+		if !slices.ContainsFunc(tls.CipherSuites(), func(cs *tls.CipherSuite) bool { return cs.Name == name }) {
+			add(fmt.Sprintf("%s.cipher_suites[%d]", key, i), "unknown or insecure cipher suite %q", name)
+		}
+	}
+	if tlsCfg.MaxVersion != "" && tlsCfg.MaxVersion < tlsCfg.MinVersion {
+		add(key+".max_version", "must not be below min_version")
+	}
+}
+
+// describe explains a failed validation rule in words
+func describe(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_if":
+		field, value, _ := strings.Cut(fe.Param(), " ")
+		return fmt.Sprintf("is required when %s is %s", snakeCase(field), value)
+	case "oneof":
+		return fmt.Sprintf("must be one of %s, got %q", strings.ReplaceAll(fe.Param(), " ", ", "), fe.Value())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "port":
+		return fmt.Sprintf("must be a port number, got %q", fe.Value())
+	case "cidr|ip":
+		return fmt.Sprintf("must be a CIDR range or an IP address, got %q", fe.Value())
+	case "hostname_port":
+		return fmt.Sprintf("must be a host:port address, got %q", fe.Value())
+	case "startswith":
+		return fmt.Sprintf("must start with %q", fe.Param())
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
+
+// snakeCase converts a Go field name to its config key, such as Store to store
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
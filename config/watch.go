@@ -0,0 +1,68 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce groups the several events an editor or a Kubernetes
+// ConfigMap update produce for a single change
+const watchDebounce = 200 * time.Millisecond
+
+// Watch calls onChange after the file at path is written, created or
+// replaced, until ctx is cancelled. The directory is watched rather than
+// the file so replacing the file by a rename or a symlink swap is noticed.
+func Watch(ctx context.Context, path string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+	path = filepath.Clean(path)
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		// Stopped timer fired once events settle
+		debounce := time.NewTimer(watchDebounce)
+		debounce.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				debounce.Stop()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if affects(event, path) {
+					debounce.Reset(watchDebounce)
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			case <-debounce.C:
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
+
+// affects reports whether a directory event may have changed the file at
+// path. Kubernetes swaps the ..data symlink when updating mounted files.
+func affects(event fsnotify.Event, path string) bool {
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	return name == path || filepath.Base(name) == "..data"
+}
@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Outcomes of an audited operation
+const (
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"
+	OutcomeFailure = "failure"
+)
+
+// redactedValue replaces the values of sensitive request body fields
+const redactedValue = "[REDACTED]"
+
+// ErrChainBroken is returned by Verify when events were altered or removed
+var ErrChainBroken = errors.New("audit chain broken")
+
+// Event records a state-changing request. Events form a hash chain: each
+// one holds the hash of its predecessor, so altering or removing an event
+// breaks the chain from there on.
+type Event struct {
+	Seq       int64          `json:"seq"`
+	Time      time.Time      `json:"time"`
+	Principal string         `json:"principal"` // user_id claim, or anonymous
+	Role      string         `json:"role,omitempty"`
+	Action    string         `json:"action"`   // create, update or delete
+	Method    string         `json:"method"`   // HTTP method
+	Resource  string         `json:"resource"` // Route template, e.g. /api/users/:id
+	Target    string         `json:"target"`   // Request path, e.g. /api/users/42
+	Outcome   string         `json:"outcome"`  // success, denied or failure
+	Status    int            `json:"status"`
+	RequestID string         `json:"request_id,omitempty"`
+	ClientIP  string         `json:"client_ip,omitempty"`
+	Changes   map[string]any `json:"changes,omitempty"` // Redacted JSON request body
+	PrevHash  string         `json:"prev_hash"`
+	Hash      string         `json:"hash"`
+}
+
+// computeHash returns the hash of the event with an empty Hash field
+func (e *Event) computeHash() string {
+	unhashed := *e
+	unhashed.Hash = ""
+	data, _ := json.Marshal(&unhashed)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// chain links e to the event with sequence number prevSeq and hash prevHash
+func (e *Event) chain(prevSeq int64, prevHash string) {
+	e.Seq = prevSeq + 1
+	e.PrevHash = prevHash
+	e.Hash = e.computeHash()
+}
+
+// Verify checks the hash of every event and the links between consecutive
+// events, given in ascending or descending order
+func Verify(events []Event) error {
+	for i := range events {
+		e := &events[i]
+		if e.computeHash() != e.Hash {
+			return fmt.Errorf("%w: event %d was altered", ErrChainBroken, e.Seq)
+		}
+		if i == 0 {
+			continue
+		}
+		prev, next := &events[i-1], e
+		if next.Seq < prev.Seq {
+			prev, next = next, prev
+		}
+		if next.Seq == prev.Seq+1 && next.PrevHash != prev.Hash {
+			return fmt.Errorf("%w: event %d does not follow event %d", ErrChainBroken, next.Seq, prev.Seq)
+		}
+	}
+	return nil
+}
+
+// Filter selects events returned by a query. Zero fields match everything.
+type Filter struct {
+	Principal string
+	Action    string
+	Resource  string // Route template or request path
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// matches reports whether e is selected by the filter
+func (f *Filter) matches(e *Event) bool {
+	return (f.Principal == "" || e.Principal == f.Principal) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Resource == "" || e.Resource == f.Resource || e.Target == f.Resource) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+// Store keeps the audit trail append-only
+type Store interface {
+	// Append chains e to the last stored event and stores it
+	Append(ctx context.Context, e *Event) error
+	// Query returns up to f.Limit matching events, newest first
+	Query(ctx context.Context, f Filter) ([]Event, error)
+	Close() error
+}
+
+// redact replaces the values of keys containing any of the sensitive words,
+// at any depth
+func redact(v any, sensitive []string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if isSensitive(k, sensitive) {
+				v[k] = redactedValue
+			} else {
+				v[k] = redact(val, sensitive)
+			}
+		}
+	case []any:
+		for i, val := range v {
+			v[i] = redact(val, sensitive)
+		}
+	}
+	return v
+}
+
+func isSensitive(key string, sensitive []string) bool {
+	key = strings.ToLower(key)
+	for _, word := range sensitive {
+		if strings.Contains(key, strings.ToLower(word)) {
+			return true
+		}
+	}
+	return false
+}
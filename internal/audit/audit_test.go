@@ -0,0 +1,168 @@
+package audit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/config"
+	"api-gateway/internal/audit"
+	"api-gateway/internal/middleware"
+)
+
+func testAuditConfig() *config.AuditConfig {
+	return &config.AuditConfig{MaxBodyBytes: 1024, Redact: []string{"password", "token"}}
+}
+
+// newAuditedRouter serves user routes through the audit middleware. The
+// X-User header stands in for the user_id claim set by JWTAuth.
+func newAuditedRouter(store audit.Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.RequestID(""))
+	api := r.Group("/api", audit.New(testAuditConfig(), store).Middleware(), func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Set("user_id", user)
+		}
+	})
+	api.POST("/users", func(c *gin.Context) {
+		// The handler still reads the body
+		var body map[string]any
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.JSON(http.StatusCreated, body)
+	})
+	api.PUT("/users/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	api.DELETE("/users/:id", func(c *gin.Context) {
+		c.Status(http.StatusForbidden)
+	})
+	api.GET("/users/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func send(r http.Handler, method, target, body, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "req-"+method)
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// testStore records requests to store and checks the events returned
+func testStore(t *testing.T, store audit.Store) {
+	r := newAuditedRouter(store)
+	w := send(r, http.MethodPost, "/api/users", `{"username":"ann","password":"secret","profile":{"api_token":"t"}}`, "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"password":"secret"`)
+	send(r, http.MethodPut, "/api/users/7", `{"email":"ann@example.com"}`, "42")
+	send(r, http.MethodDelete, "/api/users/7", "", "43")
+	send(r, http.MethodGet, "/api/users/7", "", "42")
+
+	ctx := context.Background()
+	events, err := store.Query(ctx, audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 3, "safe methods are not audited")
+	require.NoError(t, audit.Verify(events))
+
+	deleted, updated, created := events[0], events[1], events[2]
+	assert.Equal(t, int64(1), created.Seq)
+	assert.Equal(t, "anonymous", created.Principal)
+	assert.Equal(t, "create", created.Action)
+	assert.Equal(t, audit.OutcomeSuccess, created.Outcome)
+	assert.Equal(t, "req-POST", created.RequestID)
+	assert.Equal(t, map[string]any{
+		"username": "ann",
+		"password": "[REDACTED]",
+		"profile":  map[string]any{"api_token": "[REDACTED]"},
+	}, created.Changes)
+
+	assert.Equal(t, "42", updated.Principal)
+	assert.Equal(t, "update", updated.Action)
+	assert.Equal(t, "/api/users/:id", updated.Resource)
+	assert.Equal(t, "/api/users/7", updated.Target)
+	assert.Equal(t, created.Hash, updated.PrevHash)
+
+	assert.Equal(t, "delete", deleted.Action)
+	assert.Equal(t, audit.OutcomeDenied, deleted.Outcome)
+	assert.Equal(t, int64(3), deleted.Seq)
+
+	// Filters
+	events, err = store.Query(ctx, audit.Filter{Principal: "42"})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "update", events[0].Action)
+
+	events, err = store.Query(ctx, audit.Filter{Resource: "/api/users/:id", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "delete", events[0].Action)
+
+	events, err = store.Query(ctx, audit.Filter{Since: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	store, err := audit.NewFileStore(path)
+	require.NoError(t, err)
+	testStore(t, store)
+	require.NoError(t, store.Close())
+
+	// Reopening continues the chain
+	store, err = audit.NewFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	send(newAuditedRouter(store), http.MethodDelete, "/api/users/8", "", "42")
+	events, err := store.Query(context.Background(), audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	assert.Equal(t, int64(4), events[0].Seq)
+	require.NoError(t, audit.Verify(events))
+
+	// Tampering with a stored event breaks the chain
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), `"principal":"42"`, `"principal":"44"`, 1)), 0o600))
+	events, err = store.Query(context.Background(), audit.Filter{})
+	require.NoError(t, err)
+	assert.ErrorIs(t, audit.Verify(events), audit.ErrChainBroken)
+}
+
+func TestRedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	testStore(t, audit.NewRedisStore(client, "{audit}:events"))
+
+	// Another gateway instance extends the same chain
+	other := audit.NewRedisStore(client, "{audit}:events")
+	send(newAuditedRouter(other), http.MethodDelete, "/api/users/8", "", "42")
+	events, err := other.Query(context.Background(), audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	assert.Equal(t, int64(4), events[0].Seq)
+	require.NoError(t, audit.Verify(events))
+}
@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api-gateway/config"
+	"api-gateway/internal/logging"
+	"api-gateway/internal/requestid"
+)
+
+// actions maps audited methods to the action they perform
+var actions = map[string]string{
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodPatch:  "update",
+	http.MethodDelete: "delete",
+}
+
+// Auditor records state-changing requests to a Store
+type Auditor struct {
+	cfg   *config.AuditConfig
+	store Store
+}
+
+// New creates an auditor recording to store
+func New(cfg *config.AuditConfig, store Store) *Auditor {
+	return &Auditor{
+		cfg:   cfg,
+		store: store,
+	}
+}
+
+// Middleware records every POST, PUT, PATCH and DELETE request once it is
+// handled. Failing to record an event is logged but does not fail the
+// request, which has already been processed.
+func (a *Auditor) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		action, ok := actions[c.Request.Method]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		changes := a.readChanges(c.Request)
+		c.Next()
+
+		status := c.Writer.Status()
+		e := &Event{
+			Time:      time.Now().UTC(),
+			Principal: "anonymous",
+			Role:      c.GetString("role"),
+			Action:    action,
+			Method:    c.Request.Method,
+			Resource:  c.FullPath(),
+			Target:    c.Request.URL.Path,
+			Outcome:   outcome(status),
+			Status:    status,
+			RequestID: requestid.FromContext(c.Request.Context()),
+			ClientIP:  c.ClientIP(),
+			Changes:   changes,
+		}
+		// Set by JWTAuth on protected routes
+		if userID, ok := c.Get("user_id"); ok && userID != nil {
+			e.Principal = fmt.Sprint(userID)
+		}
+
+		ctx := c.Request.Context()
+		if err := a.store.Append(context.WithoutCancel(ctx), e); err != nil {
+			logging.FromContext(ctx).Error("failed to record audit event", "error", err, "action", action, "target", e.Target)
+		}
+	}
+}
+
+// readChanges returns the redacted JSON object in the request body and
+// restores the body for the handler. Bodies that are too large or not a
+// JSON object are not recorded.
+func (a *Auditor) readChanges(r *http.Request) map[string]any {
+	if r.Body == nil || r.ContentLength == 0 {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, a.cfg.MaxBodyBytes+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || int64(len(body)) > a.cfg.MaxBodyBytes {
+		return nil
+	}
+
+	var changes map[string]any
+	if json.Unmarshal(body, &changes) != nil {
+		return nil
+	}
+	redact(changes, a.cfg.Redact)
+	return changes
+}
+
+// Query returns the newest events matching f
+func (a *Auditor) Query(ctx context.Context, f Filter) ([]Event, error) {
+	return a.store.Query(ctx, f)
+}
+
+// Close closes the store
+func (a *Auditor) Close() error {
+	return a.store.Close()
+}
+
+// outcome classifies a response status
+func outcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return OutcomeDenied
+	case status >= http.StatusBadRequest:
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
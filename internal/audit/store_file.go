@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// maxLineBytes bounds the size of a stored event
+const maxLineBytes = 1 << 20
+
+// FileStore is a Store appending events as JSON lines to a file
+type FileStore struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	lastSeq  int64
+	lastHash string
+}
+
+// NewFileStore opens the audit file at path, continuing its chain
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	err := s.scan(func(e *Event) bool {
+		s.lastSeq, s.lastHash = e.Seq, e.Hash
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	s.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return s, nil
+}
+
+// Append chains e to the last event and writes it
+func (s *FileStore) Append(ctx context.Context, e *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.chain(s.lastSeq, s.lastHash)
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	s.lastSeq, s.lastHash = e.Seq, e.Hash
+	return nil
+}
+
+// Query reads the whole file, returning the newest matching events
+func (s *FileStore) Query(ctx context.Context, f Filter) ([]Event, error) {
+	var events []Event
+	err := s.scan(func(e *Event) bool {
+		if f.matches(e) {
+			events = append(events, *e)
+			if f.Limit > 0 && len(events) > f.Limit {
+				events = events[1:]
+			}
+		}
+		return ctx.Err() == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Newest first
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
+
+// scan calls fn with every event in the file until it returns false
+func (s *FileStore) scan(fn func(e *Event) bool) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), maxLineBytes)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("failed to decode audit event: %w", err)
+		}
+		if !fn(&e) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// Close closes the audit file
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
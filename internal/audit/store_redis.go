@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// appendRetries bounds the attempts to append when other gateways append
+// concurrently
+const appendRetries = 10
+
+// queryBatchSize is the number of stream entries read per command
+const queryBatchSize = 500
+
+// clockSkew widens time ranges read from the stream
+const clockSkew = time.Minute
+
+// RedisStore is a Store keeping events in a Redis stream. The sequence
+// number and hash of the last event are kept next to it so every gateway
+// instance extends the same chain.
+type RedisStore struct {
+	client  redis.UniversalClient
+	stream  string
+	headKey string
+}
+
+// NewRedisStore creates a store appending to stream. Use a hash tag such
+// as {audit}:events so the stream and its head share a cluster slot.
+func NewRedisStore(client redis.UniversalClient, stream string) *RedisStore {
+	return &RedisStore{
+		client:  client,
+		stream:  stream,
+		headKey: stream + ":head",
+	}
+}
+
+// Append chains e to the last event and adds it to the stream, retrying
+// when another gateway appended in between
+func (s *RedisStore) Append(ctx context.Context, e *Event) error {
+	for i := 0; i < appendRetries; i++ {
+		err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+			head, err := tx.Get(ctx, s.headKey).Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			var prevSeq int64
+			var prevHash string
+			if head != "" {
+				seq, hash, _ := strings.Cut(head, " ")
+				if prevSeq, err = strconv.ParseInt(seq, 10, 64); err != nil {
+					return fmt.Errorf("invalid audit head %q", head)
+				}
+				prevHash = hash
+			}
+
+			e.chain(prevSeq, prevHash)
+			data, err := json.Marshal(e)
+			if err != nil {
+				return fmt.Errorf("failed to encode audit event: %w", err)
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.XAdd(ctx, &redis.XAddArgs{Stream: s.stream, Values: []any{"event", data}})
+				pipe.Set(ctx, s.headKey, strconv.FormatInt(e.Seq, 10)+" "+e.Hash, 0)
+				return nil
+			})
+			return err
+		}, s.headKey)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to append audit event: too many concurrent appends")
+}
+
+// Query reads the stream backwards from f.Until to f.Since, returning the
+// newest matching events
+func (s *RedisStore) Query(ctx context.Context, f Filter) ([]Event, error) {
+	// Stream IDs start with the Redis time in milliseconds, which may differ
+	// from the gateway time of the event
+	start, end := "-", "+"
+	if !f.Since.IsZero() {
+		start = strconv.FormatInt(f.Since.Add(-clockSkew).UnixMilli(), 10)
+	}
+	if !f.Until.IsZero() {
+		end = strconv.FormatInt(f.Until.Add(clockSkew).UnixMilli(), 10)
+	}
+
+	var events []Event
+	for {
+		msgs, err := s.client.XRevRangeN(ctx, s.stream, end, start, queryBatchSize).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			data, _ := msg.Values["event"].(string)
+			var e Event
+			if err := json.Unmarshal([]byte(data), &e); err != nil {
+				return nil, fmt.Errorf("failed to decode audit event %s: %w", msg.ID, err)
+			}
+			if f.matches(&e) {
+				events = append(events, e)
+				if f.Limit > 0 && len(events) == f.Limit {
+					return events, nil
+				}
+			}
+		}
+		if len(msgs) < queryBatchSize {
+			return events, nil
+		}
+		end = "(" + msgs[len(msgs)-1].ID
+	}
+}
+
+// Close does nothing: the Redis client is owned by the caller
+func (s *RedisStore) Close() error {
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package certs keeps the TLS certificates served by the gateway, selecting
+// them by SNI and reloading them when their files change.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"api-gateway/config"
+)
+
+// Versions maps configured TLS versions to their crypto/tls values
+var Versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Store holds the certificates loaded from a set of key pair files
+type Store struct {
+	pairs  []config.CertificateConfig
+	certs  atomic.Pointer[[]tls.Certificate]
+	logger *slog.Logger
+}
+
+// NewStore loads the certificates of pairs
+func NewStore(pairs []config.CertificateConfig, logger *slog.Logger) (*Store, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("no certificates configured")
+	}
+	s := &Store{pairs: pairs, logger: logger}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload loads every certificate again. If any fails to load, the current
+// certificates are kept.
+func (s *Store) Reload() error {
+	certs := make([]tls.Certificate, 0, len(s.pairs))
+	for _, pair := range s.pairs {
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate %s: %w", pair.CertFile, err)
+		}
+		certs = append(certs, cert)
+	}
+	s.certs.Store(&certs)
+	return nil
+}
+
+// Watch reloads the certificates when one of their files changes, until
+// ctx is cancelled
+func (s *Store) Watch(ctx context.Context) error {
+	reload := func() {
+		if err := s.Reload(); err != nil {
+			s.logger.Error("certificate reload failed, keeping the current certificates", "error", err)
+			return
+		}
+		s.logger.Info("certificates reloaded")
+	}
+	watched := make(map[string]bool)
+	for _, pair := range s.pairs {
+		for _, path := range []string{pair.CertFile, pair.KeyFile} {
+			if watched[path] {
+				continue
+			}
+			watched[path] = true
+			if err := config.Watch(ctx, path, reload); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetCertificate returns the first certificate valid for the server name
+// the client asked for, or the first certificate when none is. It is meant
+// for tls.Config.GetCertificate.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := *s.certs.Load()
+	for i := range certs {
+		if hello.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i], nil
+		}
+	}
+	return &certs[0], nil
+}
+
+// ServerConfig returns the TLS settings of cfg serving the certificates of
+// the store
+func (s *Store) ServerConfig(cfg *config.TLSConfig) *tls.Config {
+	tlsConfig := &tls.Config{
+		GetCertificate: s.GetCertificate,
+		MinVersion:     Versions[cfg.MinVersion],
+		MaxVersion:     Versions[cfg.MaxVersion],
+	}
+	for _, name := range cfg.CipherSuites {
+		for _, cs := range tls.CipherSuites() {
+			if cs.Name == name {
+				tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, cs.ID)
+			}
+		}
+	}
+	return tlsConfig
+}
@@ -0,0 +1,115 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/config"
+	"api-gateway/internal/certs"
+	"api-gateway/internal/logging"
+)
+
+// writeCert writes a self-signed certificate for the DNS names to dir and
+// returns its key pair files
+func writeCert(t *testing.T, dir, name string, dnsNames ...string) config.CertificateConfig {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	pair := config.CertificateConfig{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	// Write the key first: the certificate file completes the pair
+	require.NoError(t, os.WriteFile(pair.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	require.NoError(t, os.WriteFile(pair.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return pair
+}
+
+func servedName(t *testing.T, store *certs.Store, serverName string) string {
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:        serverName,
+		SupportedVersions: []uint16{tls.VersionTLS13},
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+	})
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestStore_SNI(t *testing.T) {
+	dir := t.TempDir()
+	store, err := certs.NewStore([]config.CertificateConfig{
+		writeCert(t, dir, "api", "api.example.com"),
+		writeCert(t, dir, "admin", "admin.example.com", "*.admin.example.com"),
+	}, logging.Discard())
+	require.NoError(t, err)
+
+	assert.Equal(t, "api.example.com", servedName(t, store, "api.example.com"))
+	assert.Equal(t, "admin.example.com", servedName(t, store, "eu.admin.example.com"))
+	assert.Equal(t, "api.example.com", servedName(t, store, "unknown.example.com"), "the first certificate is the default")
+}
+
+func TestStore_Watch(t *testing.T) {
+	dir := t.TempDir()
+	pair := writeCert(t, dir, "api", "old.example.com")
+	store, err := certs.NewStore([]config.CertificateConfig{pair}, logging.Discard())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, store.Watch(ctx))
+
+	writeCert(t, dir, "api", "new.example.com")
+	assert.Eventually(t, func() bool {
+		return servedName(t, store, "new.example.com") == "new.example.com"
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// A broken file keeps the current certificate
+	require.NoError(t, os.WriteFile(pair.CertFile, []byte("garbage"), 0o600))
+	assert.Error(t, store.Reload())
+	assert.Equal(t, "new.example.com", servedName(t, store, "new.example.com"))
+}
+
+func TestStore_ServerConfig(t *testing.T) {
+	store, err := certs.NewStore([]config.CertificateConfig{writeCert(t, t.TempDir(), "api", "api.example.com")}, logging.Discard())
+	require.NoError(t, err)
+
+	tlsConfig := store.ServerConfig(&config.TLSConfig{
+		MinVersion:   "1.2",
+		MaxVersion:   "1.3",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	})
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MaxVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+}
@@ -0,0 +1,289 @@
+// Package clientip resolves the address of the client behind the trusted
+// proxies a request went through, and describes the forwarding to upstream
+// services.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver finds the client of requests arriving through trusted proxies
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// NewResolver creates a resolver trusting the proxies in cidrs, given as
+// CIDR ranges or single IP addresses
+func NewResolver(cidrs []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: must be a CIDR range or an IP address", cidr)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	return r, nil
+}
+
+// Trusted reports whether addr is a trusted proxy
+func (r *Resolver) Trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Forwarding describes how a request reached the gateway
+type Forwarding struct {
+	Client netip.Addr   // Invalid when the client is unknown, such as over a Unix socket
+	Chain  []netip.Addr // The client, then each proxy up to the gateway's peer
+	Proto  string       // http or https, as requested by the client
+	Host   string       // Host requested by the client
+}
+
+// Resolve returns the forwarding of req. Its peer, and the hops listed in
+// the Forwarded header, or else X-Forwarded-For or X-Real-IP, are walked
+// from right to left: the client is the first address that is not a
+// trusted proxy, so hops added by the client itself are ignored. Headers
+// are only read when the peer is trusted. Peers without an IP address,
+// such as clients of Unix sockets, are trusted as local proxies.
+func (r *Resolver) Resolve(req *http.Request) Forwarding {
+	f := Forwarding{Proto: "http", Host: req.Host}
+	if req.TLS != nil {
+		f.Proto = "https"
+	}
+
+	var current netip.Addr
+	if peer, err := netip.ParseAddrPort(req.RemoteAddr); err == nil {
+		current = peer.Addr().Unmap()
+		f.Chain = []netip.Addr{current}
+	}
+	if current.IsValid() && !r.Trusted(current) {
+		f.Client = current
+		return f
+	}
+
+	hops, elements := forwardedHops(req.Header)
+	client := len(hops) // Index of the client in hops, len(hops) for the peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !hops[i].IsValid() {
+			// An obfuscated or unknown hop hides everything before it
+			break
+		}
+		client = i
+		if !r.Trusted(hops[i]) {
+			break
+		}
+	}
+	if client < len(hops) {
+		f.Client = hops[client]
+		f.Chain = append(hops[client:len(hops):len(hops)], f.Chain...)
+	} else {
+		f.Client = current
+	}
+
+	// The proxies describe what the client requested
+	if elements != nil {
+		if client < len(elements) {
+			f.setProtoHost(elements[client]["proto"], elements[client]["host"])
+		}
+	} else {
+		// Each proxy appends its own value, so the last one comes from the
+		// gateway's trusted peer and any before it may be the client's
+		f.setProtoHost(lastValue(req.Header.Values("X-Forwarded-Proto")), lastValue(req.Header.Values("X-Forwarded-Host")))
+	}
+	return f
+}
+
+// setProtoHost sets the protocol and host reported by a proxy, ignoring
+// invalid values
+func (f *Forwarding) setProtoHost(proto, host string) {
+	proto = strings.ToLower(proto)
+	if proto == "http" || proto == "https" {
+		f.Proto = proto
+	}
+	if host != "" && !strings.ContainsAny(host, " \t\r\n,;\"") {
+		f.Host = host
+	}
+}
+
+// forwardedHops returns the addresses of the hops listed in the Forwarded
+// header with its parameters, or else in X-Forwarded-For or X-Real-IP with
+// nil parameters. Hops that are not IP addresses are invalid.
+func forwardedHops(header http.Header) ([]netip.Addr, []map[string]string) {
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		elements := parseForwarded(strings.Join(values, ","))
+		hops := make([]netip.Addr, len(elements))
+		for i, element := range elements {
+			hops[i] = parseNode(element["for"])
+		}
+		return hops, elements
+	}
+
+	var hops []netip.Addr
+	if values := header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, node := range strings.Split(strings.Join(values, ","), ",") {
+			if node = strings.TrimSpace(node); node != "" {
+				hops = append(hops, parseNode(node))
+			}
+		}
+	} else if realIP := strings.TrimSpace(header.Get("X-Real-IP")); realIP != "" {
+		hops = append(hops, parseNode(realIP))
+	}
+	return hops, nil
+}
+
+// parseForwarded parses the elements of a Forwarded header (RFC 7239),
+// such as `for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"`, into
+// their parameters with lower case names
+func parseForwarded(value string) []map[string]string {
+	var elements []map[string]string
+	for _, element := range splitQuoted(value, ',') {
+		params := make(map[string]string)
+		for _, pair := range splitQuoted(element, ';') {
+			name, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			v = strings.TrimSpace(v)
+			if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+				v = strings.ReplaceAll(v[1:len(v)-1], `\"`, `"`)
+			}
+			params[strings.ToLower(strings.TrimSpace(name))] = v
+		}
+		elements = append(elements, params)
+	}
+	return elements
+}
+
+// splitQuoted splits s at sep outside of quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseNode parses a hop given as an IP address with an optional port,
+// IPv6 addresses in brackets when they have one. Other nodes, such as
+// "unknown" or obfuscated identifiers, are invalid.
+func parseNode(node string) netip.Addr {
+	if addrPort, err := netip.ParseAddrPort(node); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	addr, err := netip.ParseAddr(strings.Trim(node, "[]"))
+	if err != nil || addr.Zone() != "" {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// lastValue returns the last of comma separated values spread over header
+// lines
+func lastValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	last := values[len(values)-1]
+	if i := strings.LastIndexByte(last, ','); i >= 0 {
+		last = last[i+1:]
+	}
+	return strings.TrimSpace(last)
+}
+
+type contextKey struct{}
+
+// WithContext returns a copy of ctx carrying the forwarding of a request
+func WithContext(ctx context.Context, f Forwarding) context.Context {
+	return context.WithValue(ctx, contextKey{}, f)
+}
+
+// FromContext returns the forwarding stored in ctx, and whether there is
+// one
+func FromContext(ctx context.Context) (Forwarding, bool) {
+	f, ok := ctx.Value(contextKey{}).(Forwarding)
+	return f, ok
+}
+
+// Inject sets the headers describing the forwarding stored in ctx on a
+// request to an upstream, replacing any the client sent: X-Forwarded-For
+// lists the client and the proxies, the gateway's peer last, and
+// Forwarded carries the same as RFC 7239 elements
+func Inject(ctx context.Context, header http.Header) {
+	f, ok := ctx.Value(contextKey{}).(Forwarding)
+	if !ok {
+		return
+	}
+
+	header.Del("X-Forwarded-For")
+	header.Del("Forwarded")
+	if len(f.Chain) > 0 {
+		xff := make([]string, len(f.Chain))
+		elements := make([]string, len(f.Chain))
+		for i, addr := range f.Chain {
+			xff[i] = addr.String()
+			elements[i] = "for=" + forwardedNode(addr)
+		}
+		// The proxy the client reached is told its protocol and host
+		elements[0] += ";proto=" + f.Proto + ";host=" + quote(f.Host)
+		header.Set("X-Forwarded-For", strings.Join(xff, ", "))
+		header.Set("Forwarded", strings.Join(elements, ", "))
+	}
+	header.Set("X-Forwarded-Proto", f.Proto)
+	header.Set("X-Forwarded-Host", f.Host)
+	if f.Client.IsValid() {
+		header.Set("X-Real-IP", f.Client.String())
+	}
+}
+
+// forwardedNode formats addr as a Forwarded node, quoting IPv6 addresses
+func forwardedNode(addr netip.Addr) string {
+	if addr.Is6() {
+		return `"[` + addr.String() + `]"`
+	}
+	return addr.String()
+}
+
+// quote returns s as a quoted string when it is not a token, such as a
+// host with a port
+func quote(s string) string {
+	if s != "" && !strings.ContainsAny(s, `:[]"\ `) {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// RemoteAddr returns req.RemoteAddr with the address of the resolved
+// client, keeping the port when the client is the peer
+func RemoteAddr(req *http.Request, f Forwarding) string {
+	if !f.Client.IsValid() {
+		return req.RemoteAddr
+	}
+	if peer, err := netip.ParseAddrPort(req.RemoteAddr); err == nil && peer.Addr().Unmap() == f.Client {
+		return req.RemoteAddr
+	}
+	return net.JoinHostPort(f.Client.String(), "0")
+}
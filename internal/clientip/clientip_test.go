@@ -0,0 +1,173 @@
+package clientip_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/internal/clientip"
+)
+
+func TestNewResolver(t *testing.T) {
+	r, err := clientip.NewResolver([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	require.NoError(t, err)
+	assert.True(t, r.Trusted(netip.MustParseAddr("10.1.2.3")))
+	assert.True(t, r.Trusted(netip.MustParseAddr("::ffff:10.1.2.3")), "IPv4-mapped addresses match IPv4 ranges")
+	assert.True(t, r.Trusted(netip.MustParseAddr("192.0.2.1")))
+	assert.False(t, r.Trusted(netip.MustParseAddr("192.0.2.2")))
+	assert.True(t, r.Trusted(netip.MustParseAddr("2001:db8::7")))
+
+	_, err = clientip.NewResolver([]string{"10.0.0.0/8", "not-a-network"})
+	assert.ErrorContains(t, err, `"not-a-network"`)
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	r, err := clientip.NewResolver([]string{"10.0.0.0/8", "::1/128"})
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name   string
+		peer   string
+		header http.Header
+		client string
+		chain  []string
+	}{
+		{
+			name:   "untrusted peer",
+			peer:   "203.0.113.7:51234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			client: "203.0.113.7",
+			chain:  []string{"203.0.113.7"},
+		},
+		{
+			name:   "trusted peer without headers",
+			peer:   "10.0.0.1:51234",
+			client: "10.0.0.1",
+			chain:  []string{"10.0.0.1"},
+		},
+		{
+			name:   "rightmost untrusted hop",
+			peer:   "10.0.0.1:51234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7", "10.0.0.2"}},
+			client: "203.0.113.7",
+			chain:  []string{"203.0.113.7", "10.0.0.2", "10.0.0.1"},
+		},
+		{
+			name:   "only trusted hops",
+			peer:   "10.0.0.1:51234",
+			header: http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			client: "10.0.0.3",
+			chain:  []string{"10.0.0.3", "10.0.0.2", "10.0.0.1"},
+		},
+		{
+			name:   "real IP",
+			peer:   "[::1]:51234",
+			header: http.Header{"X-Real-Ip": {"203.0.113.7"}},
+			client: "203.0.113.7",
+			chain:  []string{"203.0.113.7", "::1"},
+		},
+		{
+			name: "forwarded preferred",
+			peer: "10.0.0.1:51234",
+			header: http.Header{
+				"Forwarded":       {`for=198.51.100.1, for="[2001:db8::7]:4711";proto=https, for=10.0.0.2`},
+				"X-Forwarded-For": {"192.0.2.1"},
+			},
+			client: "2001:db8::7",
+			chain:  []string{"2001:db8::7", "10.0.0.2", "10.0.0.1"},
+		},
+		{
+			name:   "obfuscated hop",
+			peer:   "10.0.0.1:51234",
+			header: http.Header{"Forwarded": {"for=203.0.113.7, for=_hidden, for=10.0.0.2"}},
+			client: "10.0.0.2",
+			chain:  []string{"10.0.0.2", "10.0.0.1"},
+		},
+		{
+			name:   "invalid hop",
+			peer:   "10.0.0.1:51234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.7, garbage"}},
+			client: "10.0.0.1",
+			chain:  []string{"10.0.0.1"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.peer
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			f := r.Resolve(req)
+			assert.Equal(t, tt.client, f.Client.String())
+			var chain []string
+			for _, addr := range f.Chain {
+				chain = append(chain, addr.String())
+			}
+			assert.Equal(t, tt.chain, chain)
+		})
+	}
+}
+
+func TestResolver_ProtoHost(t *testing.T) {
+	r, err := clientip.NewResolver([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "http://internal:8080/", nil)
+	req.RemoteAddr = "10.0.0.1:51234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "api.example.com")
+	f := r.Resolve(req)
+	assert.Equal(t, "https", f.Proto)
+	assert.Equal(t, "api.example.com", f.Host)
+
+	// Values the client sent ahead of the trusted proxy's are ignored
+	req.Header.Set("X-Forwarded-Proto", "https, http")
+	req.Header.Set("X-Forwarded-Host", "evil.example.com, api.example.com")
+	f = r.Resolve(req)
+	assert.Equal(t, "http", f.Proto)
+	assert.Equal(t, "api.example.com", f.Host)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Proto", "http")
+	assert.Equal(t, "http", r.Resolve(req).Proto)
+
+	// The element of the client describes its request
+	req.Header.Set("Forwarded", `for=203.0.113.7;proto=https;host="api.example.com:8443", for=10.0.0.2;proto=http;host=internal`)
+	f = r.Resolve(req)
+	assert.Equal(t, "https", f.Proto)
+	assert.Equal(t, "api.example.com:8443", f.Host)
+
+	// Untrusted peers cannot claim anything
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.TLS = &tls.ConnectionState{}
+	f = r.Resolve(req)
+	assert.Equal(t, "https", f.Proto)
+	assert.Equal(t, "internal:8080", f.Host)
+	req.TLS = nil
+	assert.Equal(t, "http", r.Resolve(req).Proto)
+}
+
+func TestInject(t *testing.T) {
+	header := http.Header{"X-Forwarded-For": {"spoofed"}, "Forwarded": {"for=spoofed"}}
+	clientip.Inject(context.Background(), header)
+	assert.Equal(t, "spoofed", header.Get("X-Forwarded-For"), "nothing is injected without a forwarding")
+
+	ctx := clientip.WithContext(context.Background(), clientip.Forwarding{
+		Client: netip.MustParseAddr("2001:db8::7"),
+		Chain:  []netip.Addr{netip.MustParseAddr("2001:db8::7"), netip.MustParseAddr("10.0.0.1")},
+		Proto:  "https",
+		Host:   "api.example.com:8443",
+	})
+	clientip.Inject(ctx, header)
+	assert.Equal(t, "2001:db8::7, 10.0.0.1", header.Get("X-Forwarded-For"))
+	assert.Equal(t, `for="[2001:db8::7]";proto=https;host="api.example.com:8443", for=10.0.0.1`, header.Get("Forwarded"))
+	assert.Equal(t, "https", header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "api.example.com:8443", header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "2001:db8::7", header.Get("X-Real-IP"))
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"api-gateway/config"
+	"api-gateway/internal/middleware"
+	"api-gateway/internal/models/responses"
+	utilhttp "api-gateway/internal/utils/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GatewayState exposes the configuration and routes currently served
+type GatewayState interface {
+	CurrentConfig() *config.Config
+	Routes() gin.RoutesInfo
+}
+
+// UpstreamRegistry lists upstream services, drains them and resets their
+// circuit breakers
+type UpstreamRegistry interface {
+	List() []utilhttp.UpstreamStatus
+	SetDraining(service string, draining bool) bool
+	ResetBreaker(service string) bool
+}
+
+// RateLimitInspector lists and resets rate limiter buckets
+type RateLimitInspector interface {
+	Entries() []middleware.RateLimitEntry
+	Forget(key string) bool
+}
+
+// CacheInspector reports response cache statistics
+type CacheInspector interface {
+	Stats() middleware.CacheStats
+}
+
+// AdminHandler handles HTTP requests of the admin API
+type AdminHandler struct {
+	state     GatewayState
+	upstreams UpstreamRegistry
+	limiter   RateLimitInspector
+	cache     CacheInspector
+}
+
+// NewAdminHandler creates a new instance of AdminHandler
+func NewAdminHandler(state GatewayState, upstreams UpstreamRegistry, limiter RateLimitInspector, cache CacheInspector) *AdminHandler {
+	return &AdminHandler{
+		state:     state,
+		upstreams: upstreams,
+		limiter:   limiter,
+		cache:     cache,
+	}
+}
+
+// Config handles effective configuration requests
+// @Summary Show the effective configuration
+// @Description Show the configuration currently applied, with secrets redacted
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /admin/config [get]
+func (h *AdminHandler) Config(c *gin.Context) {
+	c.JSON(200, h.state.CurrentConfig().Redact())
+}
+
+// Routes handles route table requests
+// @Summary List routes
+// @Description List the routes currently served by the gateway
+// @Tags admin
+// @Produce json
+// @Success 200 {object} responses.RoutesResponse
+// @Failure 401 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /admin/routes [get]
+func (h *AdminHandler) Routes(c *gin.Context) {
+	routes := []responses.RouteResponse{}
+	for _, route := range h.state.Routes() {
+		routes = append(routes, responses.RouteResponse{
+			Method:  route.Method,
+			Path:    route.Path,
+			Handler: route.Handler,
+		})
+	}
+
+	c.JSON(200, responses.RoutesResponse{Routes: routes})
+}
+
+// Upstreams handles upstream listing requests
+// @Summary List upstreams
+// @Description List upstream services with their health as seen by recent requests
+// @Tags admin
+// @Produce json
+// @Success 200 {object} responses.UpstreamsResponse
+// @Failure 401 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /admin/upstreams [get]
+func (h *AdminHandler) Upstreams(c *gin.Context) {
+	c.JSON(200, responses.UpstreamsResponse{Upstreams: h.upstreams.List()})
+}
+
+// DrainUpstream handles draining an upstream
+// @Summary Drain an upstream
+// @Description Refuse new requests to an upstream service with 503 until it is resumed
+// @Tags admin
+// @Produce json
+// @Param name path string true "Upstream service name, e.g. user_service"
+// @Success 200 {object} responses.MessageResponse
+// @Failure 401 {object} responses.ErrorResponse
+// @Failure 404 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /admin/upstreams/{name}/drain [post]
+func (h *AdminHandler) DrainUpstream(c *gin.Context) {
+	h.setDraining(c, true, "upstream drained")
+}
+
+// ResumeUpstream handles resuming a drained upstream
+// @Summary Resume an upstream
+// @Description Send requests to a drained upstream service again
+// @Tags admin
+// @Produce json
+// @Param name path string true "Upstream service name, e.g. user_service"
+// @Success 200 {object} responses.MessageResponse
+// @Failure 401 {object} responses.ErrorResponse
+// @Failure 404 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /admin/upstreams/{name}/resume [post]
+func (h *AdminHandler) ResumeUpstream(c *gin.Context) {
+	h.setDraining(c, false, "upstream resumed")
+}
+
+func (h *AdminHandler) setDraining(c *gin.Context, draining bool, message string) {
+	if !h.upstreams.SetDraining(c.Param("name"), draining) {
+		c.JSON(404, responses.NewError(c.Request.Context(), "unknown upstream"))
+		return
+	}
+
+	c.JSON(200, responses.MessageResponse{Message: message})
+}
+
+// ResetBreaker handles resetting the circuit breaker of an upstream
+// @Summary Reset an upstream circuit breaker
+// @Description Close the circuit breaker of an upstream service and forget its failures, sending requests to it again
+// @Tags admin
+// @Produce json
+// @Param name path string true "Upstream service name, e.g. user_service"
+// @Success 200 {object} responses.MessageResponse
+// @Failure 401 {object} responses.ErrorResponse
+// @Failure 404 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /admin/upstreams/{name}/breaker/reset [post]
+func (h *AdminHandler) ResetBreaker(c *gin.Context) {
+	if !h.upstreams.ResetBreaker(c.Param("name")) {
+		c.JSON(404, responses.NewError(c.Request.Context(), "unknown upstream"))
+		return
+	}
+
+	c.JSON(200, responses.MessageResponse{Message: "circuit breaker reset"})
+}
+
+// RateLimitEntries handles rate limiter listing requests
+// @Summary List rate limiter entries
+// @Description List the token buckets of the clients tracked by the rate limiter
+// @Tags admin
+// @Produce json
+// @Success 200 {object} responses.RateLimitEntriesResponse
+// @Failure 401 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /admin/ratelimit [get]
+func (h *AdminHandler) RateLimitEntries(c *gin.Context) {
+	entries := []responses.RateLimitEntry{}
+	for _, e := range h.limiter.Entries() {
+		entries = append(entries, responses.RateLimitEntry{Key: e.Key, Tokens: e.Tokens, LastSeen: e.LastSeen})
+	}
+
+	c.JSON(200, responses.RateLimitEntriesResponse{Entries: entries})
+}
+
+// ResetRateLimit handles resetting the bucket of a client
+// @Summary Reset a rate limiter entry
+// @Description Forget the token bucket of a client, restoring its full burst
+// @Tags admin
+// @Produce json
+// @Param key query string true "Client key, e.g. 203.0.113.7"
+// @Success 200 {object} responses.MessageResponse
+// @Failure 400 {object} responses.ErrorResponse
+// @Failure 401 {object} responses.ErrorResponse
+// @Failure 404 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /admin/ratelimit [delete]
+func (h *AdminHandler) ResetRateLimit(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(400, responses.NewError(c.Request.Context(), "key is required"))
+		return
+	}
+	if !h.limiter.Forget(key) {
+		c.JSON(404, responses.NewError(c.Request.Context(), "unknown client"))
+		return
+	}
+
+	c.JSON(200, responses.MessageResponse{Message: "rate limit reset"})
+}
+
+// CacheStats handles cache statistics requests
+// @Summary Show cache statistics
+// @Description Show response cache results and in-process cache usage
+// @Tags admin
+// @Produce json
+// @Success 200 {object} responses.CacheStatsResponse
+// @Failure 401 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /admin/cache [get]
+func (h *AdminHandler) CacheStats(c *gin.Context) {
+	stats := h.cache.Stats()
+	c.JSON(200, responses.CacheStatsResponse{
+		Store:     stats.Store,
+		Results:   stats.Results,
+		L1Entries: stats.L1Entries,
+		L1Bytes:   stats.L1Bytes,
+	})
+}
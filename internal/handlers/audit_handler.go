@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"api-gateway/internal/audit"
+	"api-gateway/internal/models/responses"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits on the number of audit events returned
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditQuerier searches the audit trail
+type AuditQuerier interface {
+	Query(ctx context.Context, f audit.Filter) ([]audit.Event, error)
+}
+
+// AuditHandler handles HTTP requests for the audit trail
+type AuditHandler struct {
+	querier AuditQuerier
+}
+
+// NewAuditHandler creates a new instance of AuditHandler
+func NewAuditHandler(querier AuditQuerier) *AuditHandler {
+	return &AuditHandler{
+		querier: querier,
+	}
+}
+
+// ListEvents handles audit trail queries
+// @Summary List audit events
+// @Description List the newest recorded state-changing requests matching the filters
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Param principal query string false "Principal (user_id claim or anonymous)"
+// @Param action query string false "Action" Enums(create, update, delete)
+// @Param resource query string false "Route template or request path, e.g. /api/users/:id"
+// @Param since query string false "RFC 3339 start time, inclusive"
+// @Param until query string false "RFC 3339 end time, exclusive"
+// @Param limit query int false "Maximum number of events" default(100) maximum(1000)
+// @Success 200 {object} responses.AuditEventsResponse
+// @Failure 400 {object} responses.ErrorResponse
+// @Failure 500 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /api/admin/audit [get]
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	f := audit.Filter{
+		Principal: c.Query("principal"),
+		Action:    c.Query("action"),
+		Resource:  c.Query("resource"),
+		Limit:     defaultAuditLimit,
+	}
+
+	var err error
+	if since := c.Query("since"); since != "" {
+		if f.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			c.JSON(400, responses.NewError(c.Request.Context(), "invalid since time"))
+			return
+		}
+	}
+	if until := c.Query("until"); until != "" {
+		if f.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			c.JSON(400, responses.NewError(c.Request.Context(), "invalid until time"))
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if f.Limit, err = strconv.Atoi(limit); err != nil || f.Limit < 1 || f.Limit > maxAuditLimit {
+			c.JSON(400, responses.NewError(c.Request.Context(), "limit must be between 1 and 1000"))
+			return
+		}
+	}
+
+	events, err := h.querier.Query(c.Request.Context(), f)
+	if err != nil {
+		c.JSON(500, responses.NewError(c.Request.Context(), err.Error()))
+		return
+	}
+	if events == nil {
+		events = []audit.Event{}
+	}
+
+	c.JSON(200, responses.AuditEventsResponse{Events: events})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"api-gateway/internal/middleware"
+	"api-gateway/internal/models/responses"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CachePurger removes cached responses
+type CachePurger interface {
+	PurgeKey(ctx context.Context, key string) (int64, error)
+	PurgePrefix(ctx context.Context, prefix string) (int64, error)
+	PurgeTag(ctx context.Context, tag string) (int64, error)
+}
+
+// CacheHandler handles HTTP requests for cache administration
+type CacheHandler struct {
+	purger CachePurger
+}
+
+// NewCacheHandler creates a new instance of CacheHandler
+func NewCacheHandler(purger CachePurger) *CacheHandler {
+	return &CacheHandler{
+		purger: purger,
+	}
+}
+
+// PurgeKey handles purging a single cached URI
+// @Summary Purge a cache key
+// @Description Remove every cached variant of a request URI
+// @Tags cache
+// @Accept json
+// @Produce json
+// @Param key query string true "Request URI, e.g. /api/users?page=2"
+// @Success 200 {object} responses.PurgeResponse
+// @Failure 400 {object} responses.ErrorResponse
+// @Failure 503 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /api/admin/cache/keys [delete]
+func (h *CacheHandler) PurgeKey(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(400, responses.NewError(c.Request.Context(), "key is required"))
+		return
+	}
+
+	purged, err := h.purger.PurgeKey(c.Request.Context(), key)
+	h.respond(c, purged, err)
+}
+
+// PurgePrefix handles purging cached entries by path prefix
+// @Summary Purge cache by prefix
+// @Description Remove every cached entry whose path starts with the prefix
+// @Tags cache
+// @Accept json
+// @Produce json
+// @Param prefix query string true "Path prefix, e.g. /api/users"
+// @Success 200 {object} responses.PurgeResponse
+// @Failure 400 {object} responses.ErrorResponse
+// @Failure 503 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /api/admin/cache/prefixes [delete]
+func (h *CacheHandler) PurgePrefix(c *gin.Context) {
+	prefix := c.Query("prefix")
+	if prefix == "" {
+		c.JSON(400, responses.NewError(c.Request.Context(), "prefix is required"))
+		return
+	}
+
+	purged, err := h.purger.PurgePrefix(c.Request.Context(), prefix)
+	h.respond(c, purged, err)
+}
+
+// PurgeTag handles purging cached entries by surrogate key
+// @Summary Purge cache by tag
+// @Description Remove every cached entry tagged with the surrogate key
+// @Tags cache
+// @Accept json
+// @Produce json
+// @Param tag path string true "Surrogate key"
+// @Success 200 {object} responses.PurgeResponse
+// @Failure 503 {object} responses.ErrorResponse
+// @Security Bearer
+// @Router /api/admin/cache/tags/{tag} [delete]
+func (h *CacheHandler) PurgeTag(c *gin.Context) {
+	purged, err := h.purger.PurgeTag(c.Request.Context(), c.Param("tag"))
+	h.respond(c, purged, err)
+}
+
+// respond writes the outcome of a purge
+func (h *CacheHandler) respond(c *gin.Context, purged int64, err error) {
+	if errors.Is(err, middleware.ErrCacheDisabled) {
+		c.JSON(503, responses.NewError(c.Request.Context(), err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(500, responses.NewError(c.Request.Context(), err.Error()))
+		return
+	}
+
+	c.JSON(200, responses.PurgeResponse{Purged: purged})
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+
+	"api-gateway/internal/health"
+	"api-gateway/internal/models/responses"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthReporter runs the registered health checks
+type HealthReporter interface {
+	Run(ctx context.Context) health.Report
+}
+
+// HealthHandler handles liveness, readiness and health check requests
+type HealthHandler struct {
+	reporter HealthReporter
+	verbose  func(c *gin.Context) bool
+}
+
+// NewHealthHandler creates a new instance of HealthHandler. The results of
+// every readiness check, errors included, are only returned to requests
+// accepted by verbose, or to all when it is nil.
+func NewHealthHandler(reporter HealthReporter, verbose func(c *gin.Context) bool) *HealthHandler {
+	return &HealthHandler{
+		reporter: reporter,
+		verbose:  verbose,
+	}
+}
+
+// Livez handles liveness probes
+// @Summary Liveness probe
+// @Description Report that the process is running, without checking dependencies
+// @Tags health
+// @Produce json
+// @Success 200 {object} responses.HealthResponse
+// @Router /livez [get]
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(200, responses.HealthResponse{Status: health.StatusOK})
+}
+
+// Readyz handles readiness probes
+// @Summary Readiness probe
+// @Description Run the dependency checks. Fails when a critical check fails or the server is draining; failing non-critical checks only degrade the status.
+// @Tags health
+// @Produce json
+// @Param verbose query bool false "Include the result of every check, on internal listeners and the admin API only"
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report := h.reporter.Run(c.Request.Context())
+	status := 200
+	if !report.Ready() {
+		status = 503
+	}
+	if _, verbose := c.GetQuery("verbose"); !verbose || (h.verbose != nil && !h.verbose(c)) {
+		report.Checks = nil
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, report)
+}
+
+// Health handles health check requests. The gateway keeps serving while
+// dependencies fail, so failures degrade the status rather than fail the
+// check; use /readyz to take the gateway out of rotation.
+// @Summary Health check
+// @Description Check if the API is up and running and which dependencies are available
+// @Tags health
+// @Accept json
+// @Produce json
+// @Success 200 {object} responses.HealthResponse
+// @Router /health [get]
+func (h *HealthHandler) Health(c *gin.Context) {
+	report := h.reporter.Run(c.Request.Context())
+	resp := responses.HealthResponse{Status: report.Status}
+	if len(report.Checks) > 0 {
+		resp.Checks = make(map[string]string, len(report.Checks))
+		for name, result := range report.Checks {
+			resp.Checks[name] = result.Status
+		}
+	}
+
+	// Dependency status must not be served from the response cache
+	c.Header("Cache-Control", "no-store")
+	c.JSON(200, resp)
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"fmt"
+	"api-gateway/internal/logging"
 	"api-gateway/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -28,7 +28,8 @@ func NewTestHandler(testService services.ITestService) *TestHandler {
 // @Success 200 {object} responses.MessageResponse
 // @Router /test [get]
 func (h *TestHandler) Test(c *gin.Context) {
-	fmt.Println("TestHandler.Test")
+	logger := logging.FromContext(c.Request.Context())
+	logger.Debug("test handler started")
 	h.testService.Test(c)
-	fmt.Println("TestHandler.Test done")
+	logger.Debug("test handler done")
 }
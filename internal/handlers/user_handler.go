@@ -4,6 +4,8 @@ import (
 	"api-gateway/internal/models/requests"
 	"api-gateway/internal/models/responses"
 	"api-gateway/internal/services"
+	utilhttp "api-gateway/internal/utils/http"
+	"errors"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -21,6 +23,20 @@ func NewUserHandler(userService services.IUserService) *UserHandler {
 	}
 }
 
+// serviceError responds to a failed user service call with status, 304
+// when the upstream confirmed the cached response is current, or 503 when
+// the upstream is drained or its circuit breaker is open
+func serviceError(c *gin.Context, status int, err error) {
+	if errors.Is(err, utilhttp.ErrNotModified) {
+		c.Status(304)
+		return
+	}
+	if errors.Is(err, utilhttp.ErrUpstreamDraining) || errors.Is(err, utilhttp.ErrCircuitOpen) {
+		status = 503
+	}
+	c.JSON(status, responses.NewError(c.Request.Context(), err.Error()))
+}
+
 // CreateUser handles user creation requests
 // @Summary Create a new user
 // @Description Create a new user with the provided information
@@ -34,13 +50,13 @@ func NewUserHandler(userService services.IUserService) *UserHandler {
 func (h *UserHandler) CreateUser(c *gin.Context) {
 	var req requests.CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, responses.ErrorResponse{Error: err.Error()})
+		c.JSON(400, responses.NewError(c.Request.Context(), err.Error()))
 		return
 	}
 
 	user, err := h.userService.CreateUser(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(400, responses.ErrorResponse{Error: err.Error()})
+		serviceError(c, 400, err)
 		return
 	}
 
@@ -62,13 +78,13 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 func (h *UserHandler) GetUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(400, responses.ErrorResponse{Error: "invalid user ID"})
+		c.JSON(400, responses.NewError(c.Request.Context(), "invalid user ID"))
 		return
 	}
 
 	user, err := h.userService.GetUserByID(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(404, responses.ErrorResponse{Error: err.Error()})
+		serviceError(c, 404, err)
 		return
 	}
 
@@ -91,19 +107,19 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 func (h *UserHandler) UpdateUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(400, responses.ErrorResponse{Error: "invalid user ID"})
+		c.JSON(400, responses.NewError(c.Request.Context(), "invalid user ID"))
 		return
 	}
 
 	var req requests.UpdateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, responses.ErrorResponse{Error: err.Error()})
+		c.JSON(400, responses.NewError(c.Request.Context(), err.Error()))
 		return
 	}
 
 	user, err := h.userService.UpdateUser(c.Request.Context(), uint(id), &req)
 	if err != nil {
-		c.JSON(400, responses.ErrorResponse{Error: err.Error()})
+		serviceError(c, 400, err)
 		return
 	}
 
@@ -125,12 +141,12 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(400, responses.ErrorResponse{Error: "invalid user ID"})
+		c.JSON(400, responses.NewError(c.Request.Context(), "invalid user ID"))
 		return
 	}
 
 	if err := h.userService.DeleteUser(c.Request.Context(), uint(id)); err != nil {
-		c.JSON(400, responses.ErrorResponse{Error: err.Error()})
+		serviceError(c, 400, err)
 		return
 	}
 
@@ -154,7 +170,7 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 
 	users, err := h.userService.ListUsers(c.Request.Context(), page, pageSize)
 	if err != nil {
-		c.JSON(400, responses.ErrorResponse{Error: err.Error()})
+		serviceError(c, 400, err)
 		return
 	}
 
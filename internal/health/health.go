@@ -0,0 +1,224 @@
+// Package health runs the dependency checks behind the liveness and
+// readiness endpoints.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Report and check statuses
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded" // A non-critical check is failing
+	StatusFailing  = "failing"  // A critical check is failing or the server is draining
+	StatusDraining = "draining" // A dependency was taken out of service on purpose
+)
+
+// ErrDraining is reported while the server shuts down
+var ErrDraining = errors.New("server is draining")
+
+// ErrOutOfService is wrapped by the errors of checks whose dependency was
+// taken out of service on purpose, such as a drained upstream. They are
+// reported as draining without affecting readiness.
+var ErrOutOfService = errors.New("out of service")
+
+// defaultTimeout bounds checks registered without a timeout
+const defaultTimeout = 2 * time.Second
+
+// CheckFunc reports whether a dependency is usable
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named dependency check
+type Check struct {
+	Name     string
+	Run      CheckFunc
+	Timeout  time.Duration // 0 means the default of 2s
+	Critical bool          // Whether a failure makes the server unready, rather than degraded
+}
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Status   string `json:"status" example:"ok"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration" example:"1.2ms"`
+}
+
+// Report is the outcome of every registered check
+type Report struct {
+	Status string                 `json:"status" example:"ok"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Ready reports whether the server should receive traffic
+func (r Report) Ready() bool {
+	return r.Status != StatusFailing
+}
+
+// Checker is a registry of health checks, run concurrently on demand
+type Checker struct {
+	mu       sync.RWMutex
+	checks   map[string]Check
+	draining atomic.Bool
+
+	// Results are reused for cacheTTL so frequent probes do not load the
+	// dependencies, and concurrent runs share one
+	cacheMu  sync.Mutex
+	cacheTTL time.Duration
+	cached   *Report
+	cachedAt time.Time
+	inflight singleflight.Group
+}
+
+// NewChecker creates an empty check registry
+func NewChecker() *Checker {
+	return &Checker{checks: make(map[string]Check)}
+}
+
+// Register adds a check, replacing any check of the same name
+func (h *Checker) Register(check Check) {
+	if check.Timeout <= 0 {
+		check.Timeout = defaultTimeout
+	}
+	h.mu.Lock()
+	h.checks[check.Name] = check
+	h.mu.Unlock()
+	h.invalidate()
+}
+
+// SetCacheTTL sets how long check results are reused, 0 to run the checks
+// on every call
+func (h *Checker) SetCacheTTL(ttl time.Duration) {
+	h.cacheMu.Lock()
+	h.cacheTTL = ttl
+	h.cacheMu.Unlock()
+	h.invalidate()
+}
+
+// invalidate drops the cached results
+func (h *Checker) invalidate() {
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+	h.cached = nil
+}
+
+// SetDraining marks the server as shutting down, failing readiness so load
+// balancers stop sending new requests
+func (h *Checker) SetDraining(draining bool) {
+	h.draining.Store(draining)
+}
+
+// Run runs every check concurrently, each bounded by its timeout, or
+// returns the results of a run less than the cache TTL ago
+func (h *Checker) Run(ctx context.Context) Report {
+	report := h.results(ctx)
+	checks := make(map[string]CheckResult, len(report.Checks)+1)
+	for name, result := range report.Checks {
+		checks[name] = result
+	}
+	report.Checks = checks
+
+	if h.draining.Load() {
+		report.Status = StatusFailing
+		report.Checks["shutdown"] = CheckResult{Status: StatusFailing, Critical: true, Error: ErrDraining.Error(), Duration: "0s"}
+	}
+	return report
+}
+
+// results returns the cached results, running the checks when they are
+// missing or expired
+func (h *Checker) results(ctx context.Context) Report {
+	h.cacheMu.Lock()
+	ttl := h.cacheTTL
+	if h.cached != nil && time.Since(h.cachedAt) < ttl {
+		report := *h.cached
+		h.cacheMu.Unlock()
+		return report
+	}
+	h.cacheMu.Unlock()
+	if ttl <= 0 {
+		return h.runChecks(ctx)
+	}
+
+	// Callers share the run, so it must not end with the first of them
+	v, _, _ := h.inflight.Do("checks", func() (any, error) {
+		report := h.runChecks(context.WithoutCancel(ctx))
+		h.cacheMu.Lock()
+		h.cached, h.cachedAt = &report, time.Now()
+		h.cacheMu.Unlock()
+		return report, nil
+	})
+	return v.(Report)
+}
+
+// runChecks runs every check concurrently
+func (h *Checker) runChecks(ctx context.Context) Report {
+	h.mu.RLock()
+	checks := make([]Check, 0, len(h.checks))
+	for _, check := range h.checks {
+		checks = append(checks, check)
+	}
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for i, check := range checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		switch {
+		case result.Status == StatusOK, result.Status == StatusDraining:
+		case check.Critical:
+			report.Status = StatusFailing
+		case report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run runs a single check under its timeout. A check ignoring its context
+// is reported as failed once the timeout passes.
+func run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.Run(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result := CheckResult{
+		Status:   StatusOK,
+		Critical: check.Critical,
+		Duration: time.Since(start).Round(time.Microsecond).String(),
+	}
+	switch {
+	case errors.Is(err, ErrOutOfService):
+		result.Status = StatusDraining
+		result.Error = err.Error()
+	case err != nil:
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,113 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"api-gateway/internal/health"
+)
+
+func check(name string, critical bool, err error) health.Check {
+	return health.Check{
+		Name:     name,
+		Critical: critical,
+		Run:      func(context.Context) error { return err },
+	}
+}
+
+func TestChecker_Run(t *testing.T) {
+	h := health.NewChecker()
+	assert.Equal(t, health.StatusOK, h.Run(context.Background()).Status)
+
+	h.Register(check("store", true, nil))
+	h.Register(check("cache", false, errors.New("connection refused")))
+	report := h.Run(context.Background())
+	assert.Equal(t, health.StatusDegraded, report.Status, "non-critical failures degrade")
+	assert.True(t, report.Ready())
+	assert.Equal(t, "connection refused", report.Checks["cache"].Error)
+	assert.Equal(t, health.StatusOK, report.Checks["store"].Status)
+
+	// Dependencies out of service on purpose do not affect the status
+	h.Register(check("upstream", true, fmt.Errorf("%w: upstream is draining", health.ErrOutOfService)))
+	report = h.Run(context.Background())
+	assert.Equal(t, health.StatusDegraded, report.Status)
+	assert.Equal(t, health.StatusDraining, report.Checks["upstream"].Status)
+	assert.Equal(t, "out of service: upstream is draining", report.Checks["upstream"].Error)
+
+	// Registering a check again replaces it
+	h.Register(check("store", true, errors.New("unreachable")))
+	report = h.Run(context.Background())
+	assert.Equal(t, health.StatusFailing, report.Status)
+	assert.False(t, report.Ready())
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	h := health.NewChecker()
+	h.Register(health.Check{
+		Name:     "slow",
+		Critical: true,
+		Timeout:  10 * time.Millisecond,
+		Run: func(context.Context) error {
+			// Ignores its context
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+
+	start := time.Now()
+	report := h.Run(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, health.StatusFailing, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+}
+
+func TestChecker_Draining(t *testing.T) {
+	h := health.NewChecker()
+	h.Register(check("store", true, nil))
+
+	h.SetDraining(true)
+	report := h.Run(context.Background())
+	assert.False(t, report.Ready())
+	assert.Equal(t, health.ErrDraining.Error(), report.Checks["shutdown"].Error)
+}
+
+func TestChecker_CacheTTL(t *testing.T) {
+	h := health.NewChecker()
+	var runs atomic.Int32
+	h.Register(health.Check{
+		Name:     "upstream",
+		Critical: true,
+		Run: func(context.Context) error {
+			runs.Add(1)
+			return nil
+		},
+	})
+
+	// Results are reused within the TTL
+	h.SetCacheTTL(time.Minute)
+	for range 3 {
+		assert.True(t, h.Run(context.Background()).Ready())
+	}
+	assert.Equal(t, int32(1), runs.Load())
+
+	// Draining applies to cached results at once
+	h.SetDraining(true)
+	assert.False(t, h.Run(context.Background()).Ready())
+	h.SetDraining(false)
+	report := h.Run(context.Background())
+	assert.True(t, report.Ready())
+	assert.NotContains(t, report.Checks, "shutdown")
+	assert.Equal(t, int32(1), runs.Load())
+
+	// Without a TTL the checks run every time
+	h.SetCacheTTL(0)
+	h.Run(context.Background())
+	h.Run(context.Background())
+	assert.Equal(t, int32(3), runs.Load())
+}
@@ -0,0 +1,228 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/config"
+)
+
+// clfTimeFormat is the timestamp format of the Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// DefaultAccessFields are the fields of json access lines unless configured
+var DefaultAccessFields = []string{
+	"time", "request_id", "method", "path", "route", "status", "latency_ms",
+	"bytes_in", "bytes_out", "client_ip", "user_agent", "upstream", "cache",
+}
+
+// AccessEntry describes a handled request
+type AccessEntry struct {
+	Time      time.Time
+	Latency   time.Duration
+	Method    string
+	Path      string
+	Query     string
+	Proto     string
+	Route     string // Route template, empty if no route matched
+	Status    int
+	BytesIn   int64
+	BytesOut  int64
+	ClientIP  string
+	UserAgent string
+	Referer   string
+	User      string // Authenticated principal, empty if anonymous
+	Upstream  string // Upstream services called, comma separated
+	Cache     string // X-Cache result
+	RequestID string
+	TraceID   string
+}
+
+// accessFields renders the json fields of an entry
+var accessFields = map[string]func(e *AccessEntry) any{
+	"time":       func(e *AccessEntry) any { return e.Time.Format(time.RFC3339Nano) },
+	"latency_ms": func(e *AccessEntry) any { return float64(e.Latency.Microseconds()) / 1000 },
+	"method":     func(e *AccessEntry) any { return e.Method },
+	"path":       func(e *AccessEntry) any { return e.Path },
+	"query":      func(e *AccessEntry) any { return e.Query },
+	"proto":      func(e *AccessEntry) any { return e.Proto },
+	"route":      func(e *AccessEntry) any { return e.Route },
+	"status":     func(e *AccessEntry) any { return e.Status },
+	"bytes_in":   func(e *AccessEntry) any { return e.BytesIn },
+	"bytes_out":  func(e *AccessEntry) any { return e.BytesOut },
+	"client_ip":  func(e *AccessEntry) any { return e.ClientIP },
+	"user_agent": func(e *AccessEntry) any { return e.UserAgent },
+	"referer":    func(e *AccessEntry) any { return e.Referer },
+	"user":       func(e *AccessEntry) any { return e.User },
+	"upstream":   func(e *AccessEntry) any { return e.Upstream },
+	"cache":      func(e *AccessEntry) any { return e.Cache },
+	"request_id": func(e *AccessEntry) any { return e.RequestID },
+	"trace_id":   func(e *AccessEntry) any { return e.TraceID },
+}
+
+// AccessLogger writes one line per request in the Common, Combined or a
+// JSON log format
+type AccessLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+
+	format            string
+	fields            []string
+	skip              map[string]bool
+	successSampleRate float64
+}
+
+// NewAccessLogger creates an access logger writing to the configured
+// output, rotated like the application log
+func NewAccessLogger(cfg *config.LogConfig) (*AccessLogger, error) {
+	access := &cfg.Access
+	format := strings.ToLower(access.Format)
+	switch format {
+	case "":
+		format = "json"
+	case "json", "common", "combined":
+	default:
+		return nil, fmt.Errorf("invalid access log format %q", access.Format)
+	}
+
+	fields := access.Fields
+	if len(fields) == 0 {
+		fields = DefaultAccessFields
+	}
+	for _, field := range fields {
+		if accessFields[field] == nil {
+			return nil, fmt.Errorf("unknown access log field %q", field)
+		}
+	}
+
+	w, closer, err := openOutput(access.Output, cfg.MaxSizeMB, cfg.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := make(map[string]bool, len(access.Skip))
+	for _, s := range access.Skip {
+		skip[s] = true
+	}
+	return &AccessLogger{
+		w:                 w,
+		closer:            closer,
+		format:            format,
+		fields:            slices.Clone(fields),
+		skip:              skip,
+		successSampleRate: cfg.SuccessSampleRate,
+	}, nil
+}
+
+// Log writes the line of e unless its route or path is skipped or it is a
+// successful request left out by sampling. Failures are always logged.
+func (l *AccessLogger) Log(e *AccessEntry) {
+	if l.skip[e.Route] || l.skip[e.Path] {
+		return
+	}
+	if e.Status < http.StatusBadRequest && l.successSampleRate < 1 && rand.Float64() >= l.successSampleRate {
+		return
+	}
+
+	var buf bytes.Buffer
+	switch l.format {
+	case "common":
+		l.writeCommon(&buf, e)
+	case "combined":
+		l.writeCommon(&buf, e)
+		fmt.Fprintf(&buf, " %s %s", strconv.Quote(e.Referer), strconv.Quote(e.UserAgent))
+	default:
+		l.writeJSON(&buf, e)
+	}
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(buf.Bytes())
+}
+
+// writeCommon writes e in the Common Log Format
+func (l *AccessLogger) writeCommon(buf *bytes.Buffer, e *AccessEntry) {
+	uri := e.Path
+	if e.Query != "" {
+		uri += "?" + e.Query
+	}
+	size := "-"
+	if e.BytesOut > 0 {
+		size = strconv.FormatInt(e.BytesOut, 10)
+	}
+	fmt.Fprintf(buf, "%s - %s [%s] %s %d %s",
+		orDash(e.ClientIP), orDash(e.User), e.Time.Format(clfTimeFormat),
+		strconv.Quote(e.Method+" "+uri+" "+e.Proto), e.Status, size)
+}
+
+// writeJSON writes the configured fields of e as a JSON object
+func (l *AccessLogger) writeJSON(buf *bytes.Buffer, e *AccessEntry) {
+	buf.WriteByte('{')
+	for i, field := range l.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field)
+		value, _ := json.Marshal(accessFields[field](e))
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+}
+
+// Close releases the log file
+func (l *AccessLogger) Close() error {
+	return l.closer.Close()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+type upstreamsKey struct{}
+
+// upstreams collects the upstream services called for a request
+type upstreams struct {
+	mu    sync.Mutex
+	names []string
+}
+
+// WithUpstreams returns a copy of ctx recording the upstream services called
+// with it, and a function returning them comma separated
+func WithUpstreams(ctx context.Context) (context.Context, func() string) {
+	u := &upstreams{}
+	return context.WithValue(ctx, upstreamsKey{}, u), func() string {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		return strings.Join(u.names, ",")
+	}
+}
+
+// RecordUpstream notes that the request of ctx called service
+func RecordUpstream(ctx context.Context, service string) {
+	u, ok := ctx.Value(upstreamsKey{}).(*upstreams)
+	if !ok {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !slices.Contains(u.names, service) {
+		u.names = append(u.names, service)
+	}
+}
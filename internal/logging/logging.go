@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"api-gateway/config"
+)
+
+type loggerKey struct{}
+
+// New creates a logger writing to the configured output in the configured
+// format and level. File outputs are rotated by size. The returned closer
+// releases a log file and is a no-op for stdout and stderr.
+func New(cfg *config.LogConfig) (*slog.Logger, io.Closer, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, nil, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+
+	w, closer, err := openOutput(cfg.Output, cfg.MaxSizeMB, cfg.MaxBackups)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.Format) {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), closer, nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), closer, nil
+	default:
+		closer.Close()
+		return nil, nil, fmt.Errorf("invalid log format %q", cfg.Format)
+	}
+}
+
+// Discard returns a logger that drops every record
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+// WithContext returns a copy of ctx carrying logger
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the request-scoped logger stored in ctx, or the
+// default logger when there is none
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,97 @@
+package logging_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/config"
+	"api-gateway/internal/logging"
+)
+
+func TestNew_RotatesFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	logger, closer, err := logging.New(&config.LogConfig{Level: "info", Output: path, MaxSizeMB: 1, MaxBackups: 2})
+	require.NoError(t, err)
+
+	// Write about 4MB so the file is rotated several times
+	payload := strings.Repeat("x", 1024)
+	for i := 0; i < 4096; i++ {
+		logger.Info("line", "payload", payload)
+	}
+	require.NoError(t, closer.Close())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "the current file and two backups are kept")
+	for _, e := range entries {
+		info, err := e.Info()
+		require.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(1<<20))
+	}
+}
+
+func TestNew_SharedOutput(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gateway.log")
+	cfg := &config.LogConfig{Level: "info", Output: path, MaxSizeMB: 1, SuccessSampleRate: 1,
+		Access: config.AccessLogConfig{Output: path, Format: "common"}}
+	logger, closer, err := logging.New(cfg)
+	require.NoError(t, err)
+	access, err := logging.NewAccessLogger(cfg)
+	require.NoError(t, err)
+
+	// Both logs write about 2MB to the same rotated file
+	payload := strings.Repeat("x", 1024)
+	for i := 0; i < 2048; i++ {
+		logger.Info("line", "payload", payload)
+		access.Log(&logging.AccessEntry{Time: time.Now(), Method: "GET", Path: "/" + payload, Status: 200})
+	}
+	require.NoError(t, access.Close())
+	logger.Info("after the access log is closed")
+	require.NoError(t, closer.Close())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Greater(t, len(entries), 3)
+	var lines int
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(data), 1<<20, "files are rotated once")
+		lines += strings.Count(string(data), "\n")
+	}
+	assert.Equal(t, 2*2048+1, lines, "no line is lost")
+}
+
+func TestNew_RotationRecovers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	logger, closer, err := logging.New(&config.LogConfig{Level: "info", Output: path, MaxSizeMB: 1})
+	require.NoError(t, err)
+	defer closer.Close()
+
+	// A file moved away is replaced on the next rotation
+	logger.Info("first")
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "moved.log")))
+	logger.Info("line", "payload", strings.Repeat("x", 1<<20))
+	logger.Info("last")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "last")
+}
+
+func TestNewAccessLogger_InvalidConfig(t *testing.T) {
+	_, err := logging.NewAccessLogger(&config.LogConfig{Access: config.AccessLogConfig{Format: "xml"}})
+	assert.Error(t, err)
+
+	_, err = logging.NewAccessLogger(&config.LogConfig{Access: config.AccessLogConfig{Fields: []string{"status", "bogus"}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names rotated files so they sort by age
+const backupTimeFormat = "20060102T150405.000000000"
+
+// openOutput opens stdout, stderr or a file rotated once it exceeds
+// maxSizeMB. The returned closer is a no-op for stdout and stderr.
+func openOutput(output string, maxSizeMB, maxBackups int) (io.Writer, io.Closer, error) {
+	switch output {
+	case "", "stdout":
+		return os.Stdout, nopCloser{}, nil
+	case "stderr":
+		return os.Stderr, nopCloser{}, nil
+	default:
+		f, err := openRotatingFile(output, int64(maxSizeMB)<<20, maxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, f, nil
+	}
+}
+
+// rotatingFile is a log file renamed with a timestamp suffix and replaced
+// by a new file once it grows past maxSize. Outputs naming the same path
+// share one rotatingFile so they do not rotate each other's file.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	key        string // Absolute path identifying the file in openFiles
+	maxSize    int64  // 0 disables rotation
+	maxBackups int    // 0 keeps every rotated file
+	file       *os.File
+	size       int64
+	refs       int // Outputs using the file, guarded by openFilesMu
+}
+
+var (
+	openFilesMu sync.Mutex
+	openFiles   = make(map[string]*rotatingFile)
+)
+
+// openRotatingFile opens the log file at path, or returns the file already
+// opened for it. The limits of the first opener apply.
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	openFilesMu.Lock()
+	defer openFilesMu.Unlock()
+	if f, ok := openFiles[key]; ok {
+		f.refs++
+		return f, nil
+	}
+
+	f := &rotatingFile{path: path, key: key, maxSize: maxSize, maxBackups: maxBackups, refs: 1}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	openFiles[key] = f
+	return f, nil
+}
+
+// open opens the log file for appending
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past its limit.
+// When rotation fails p is still appended to the current file.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rotateErr error
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		rotateErr = f.rotate()
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate renames the current file and opens a new one. The current file
+// stays open until its replacement is, so a failure loses no records; the
+// rotation is retried on the next write.
+func (f *rotatingFile) rotate() error {
+	backup := f.path + "." + time.Now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	// The file was renamed, or moved away by someone else
+
+	current := f.file
+	if err := f.open(); err != nil {
+		return err
+	}
+	current.Close()
+	f.prune()
+	return nil
+}
+
+// prune removes the oldest rotated files beyond maxBackups
+func (f *rotatingFile) prune() {
+	if f.maxBackups <= 0 {
+		return
+	}
+	matches, _ := filepath.Glob(f.path + ".*")
+	var backups []string
+	for _, m := range matches {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(m, f.path+".")); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > f.maxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+// Close closes the current file once every output using it is closed
+func (f *rotatingFile) Close() error {
+	openFilesMu.Lock()
+	f.refs--
+	if f.refs > 0 {
+		openFilesMu.Unlock()
+		return nil
+	}
+	if openFiles[f.key] == f {
+		delete(openFiles, f.key)
+	}
+	openFilesMu.Unlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,209 @@
+package metrics
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric name
+const namespace = "gateway"
+
+// unmatchedRoute labels requests that matched no route, keeping the label
+// set bounded
+const unmatchedRoute = "unmatched"
+
+// cacheResults are the X-Cache values counted as cache outcomes
+var cacheResults = map[string]bool{
+	"HIT":         true,
+	"MISS":        true,
+	"STALE":       true,
+	"REVALIDATED": true,
+	"BYPASS":      true,
+}
+
+// breakerStates are the circuit breaker states reported by the breaker
+// gauge
+var breakerStates = []string{"closed", "open", "half_open"}
+
+// Metrics holds the Prometheus collectors of the gateway in their own
+// registry
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	inFlight         prometheus.Gauge
+	upstreamDuration *prometheus.HistogramVec
+	upstreamErrors   *prometheus.CounterVec
+	upstreamInFlight *prometheus.GaugeVec
+	upstreamBreaker  *prometheus.GaugeVec
+	cacheResults     *prometheus.CounterVec
+	rateLimited      prometheus.Counter
+}
+
+// New creates and registers the gateway collectors along with the Go
+// runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by route template, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time to handle HTTP requests, by route template, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests currently being handled.",
+		}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_request_duration_seconds",
+			Help:      "Time to complete upstream requests, by service, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"service", "method", "status"}),
+		upstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upstream_errors_total",
+			Help:      "Failed upstream requests, by service and reason.",
+		}, []string{"service", "reason"}),
+		upstreamInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "upstream_requests_in_flight",
+			Help:      "Upstream requests currently waiting for a response, by service.",
+		}, []string{"service"}),
+		upstreamBreaker: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "upstream_circuit_breaker_state",
+			Help:      "Circuit breaker state of upstream services, 1 for the current state and 0 for the others.",
+		}, []string{"service", "state"}),
+		cacheResults: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_requests_total",
+			Help:      "GET requests seen by the response cache, by result.",
+		}, []string{"result"}),
+		rateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_rejections_total",
+			Help:      "Requests rejected by the rate limiter.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.inFlight,
+		m.upstreamDuration,
+		m.upstreamErrors,
+		m.upstreamInFlight,
+		m.upstreamBreaker,
+		m.cacheResults,
+		m.rateLimited,
+	)
+	return m
+}
+
+// Registry returns the registry holding the gateway collectors
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		// Scrapes must always see current values
+		c.Header("Cache-Control", "no-store")
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// Middleware records request counts, latency and the cache outcome. It
+// should run before every other middleware so rejected and recovered
+// requests are counted too.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		m.requests.WithLabelValues(route, c.Request.Method, status).Inc()
+		m.requestDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+
+		if result := c.Writer.Header().Get("X-Cache"); cacheResults[result] {
+			m.cacheResults.WithLabelValues(result).Inc()
+		}
+	}
+}
+
+// RateLimited counts a request rejected by the rate limiter
+func (m *Metrics) RateLimited() {
+	m.rateLimited.Inc()
+}
+
+// StartUpstream tracks an upstream request, implementing the HTTPSender
+// observer interface
+func (m *Metrics) StartUpstream(service, method string) func(status int, err error) {
+	start := time.Now()
+	inFlight := m.upstreamInFlight.WithLabelValues(service)
+	inFlight.Inc()
+
+	return func(status int, err error) {
+		inFlight.Dec()
+		m.upstreamDuration.WithLabelValues(service, method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+		if err != nil {
+			m.upstreamErrors.WithLabelValues(service, errorReason(status, err)).Inc()
+		}
+	}
+}
+
+// SetBreakerState records the circuit breaker state of an upstream service
+func (m *Metrics) SetBreakerState(service, state string) {
+	for _, s := range breakerStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		m.upstreamBreaker.WithLabelValues(service, s).Set(value)
+	}
+}
+
+// errorReason classifies an upstream failure into a bounded label value
+func errorReason(status int, err error) string {
+	var netErr net.Error
+	switch {
+	case status >= http.StatusInternalServerError:
+		return "server_error"
+	case status >= http.StatusBadRequest:
+		return "client_error"
+	case status != 0:
+		return "decode"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "transport"
+	}
+}
@@ -0,0 +1,97 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/internal/metrics"
+	utilhttp "api-gateway/internal/utils/http"
+)
+
+func TestMetrics_Middleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := metrics.New()
+
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/users/:id", func(c *gin.Context) {
+		c.Header("X-Cache", "HIT")
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/metrics", m.Handler())
+
+	for _, target := range []string{"/users/1", "/users/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	expected := `
+# HELP gateway_http_requests_total HTTP requests handled, by route template, method and status.
+# TYPE gateway_http_requests_total counter
+gateway_http_requests_total{method="GET",route="/users/:id",status="200"} 2
+gateway_http_requests_total{method="GET",route="unmatched",status="404"} 1
+# HELP gateway_cache_requests_total GET requests seen by the response cache, by result.
+# TYPE gateway_cache_requests_total counter
+gateway_cache_requests_total{result="HIT"} 2
+`
+	require.NoError(t, testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected),
+		"gateway_http_requests_total", "gateway_cache_requests_total"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), "gateway_http_request_duration_seconds_bucket")
+}
+
+func TestMetrics_Upstream(t *testing.T) {
+	m := metrics.New()
+
+	m.StartUpstream("user_service", http.MethodGet)(http.StatusOK, nil)
+	m.StartUpstream("user_service", http.MethodGet)(http.StatusBadGateway, errors.New("bad gateway"))
+	m.StartUpstream("user_service", http.MethodPost)(0, errors.New("connection refused"))
+	m.RateLimited()
+
+	expected := `
+# HELP gateway_upstream_errors_total Failed upstream requests, by service and reason.
+# TYPE gateway_upstream_errors_total counter
+gateway_upstream_errors_total{reason="server_error",service="user_service"} 1
+gateway_upstream_errors_total{reason="transport",service="user_service"} 1
+# HELP gateway_upstream_requests_in_flight Upstream requests currently waiting for a response, by service.
+# TYPE gateway_upstream_requests_in_flight gauge
+gateway_upstream_requests_in_flight{service="user_service"} 0
+# HELP gateway_rate_limit_rejections_total Requests rejected by the rate limiter.
+# TYPE gateway_rate_limit_rejections_total counter
+gateway_rate_limit_rejections_total 1
+`
+	require.NoError(t, testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected),
+		"gateway_upstream_errors_total", "gateway_upstream_requests_in_flight", "gateway_rate_limit_rejections_total"))
+	assert.Equal(t, 3, testutil.CollectAndCount(m.Registry(), "gateway_upstream_request_duration_seconds"))
+}
+
+func TestMetrics_Breaker(t *testing.T) {
+	m := metrics.New()
+	upstreams := utilhttp.NewUpstreams(m)
+	upstreams.SetBreaker("user_service", utilhttp.BreakerSettings{Failures: 2, OpenDuration: time.Minute})
+
+	for range 2 {
+		upstreams.StartUpstream("user_service", http.MethodGet)(http.StatusBadGateway, errors.New("bad gateway"))
+	}
+
+	expected := `
+# HELP gateway_upstream_circuit_breaker_state Circuit breaker state of upstream services, 1 for the current state and 0 for the others.
+# TYPE gateway_upstream_circuit_breaker_state gauge
+gateway_upstream_circuit_breaker_state{service="user_service",state="closed"} 0
+gateway_upstream_circuit_breaker_state{service="user_service",state="half_open"} 0
+gateway_upstream_circuit_breaker_state{service="user_service",state="open"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected), "gateway_upstream_circuit_breaker_state"))
+}
@@ -1,32 +1,46 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+
+	"api-gateway/internal/logging"
+	"api-gateway/internal/models/responses"
 )
 
-var jwtSecret []byte
+// jwtSecret holds the []byte HMAC key, replaced when the configuration is
+// reloaded
+var jwtSecret atomic.Value
 
-// SetJWTSecret sets the JWT secret key
+// SetJWTSecret sets the JWT secret key. It is safe to call while requests
+// are being served.
 func SetJWTSecret(secret string) {
-	jwtSecret = []byte(secret)
+	jwtSecret.Store([]byte(secret))
+}
+
+// loadJWTSecret returns the JWT secret key, nil if none is set
+func loadJWTSecret() []byte {
+	secret, _ := jwtSecret.Load().([]byte)
+	return secret
 }
 
 // JWTAuth middleware for validating JWT tokens
 func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if jwtSecret == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT secret not configured"})
+		if loadJWTSecret() == nil {
+			c.JSON(http.StatusInternalServerError, responses.NewError(c.Request.Context(), "JWT secret not configured"))
 			c.Abort()
 			return
 		}
 
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			c.JSON(http.StatusUnauthorized, responses.NewError(c.Request.Context(), "Authorization header is required"))
 			c.Abort()
 			return
 		}
@@ -34,22 +48,14 @@ func JWTAuth() gin.HandlerFunc {
 		// Bearer token format
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+			c.JSON(http.StatusUnauthorized, responses.NewError(c.Request.Context(), "Invalid authorization header format"))
 			c.Abort()
 			return
 		}
 
-		tokenString := parts[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return jwtSecret, nil
-		})
-
+		token, err := parseToken(parts[1])
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.JSON(http.StatusUnauthorized, responses.NewError(c.Request.Context(), "Invalid token"))
 			c.Abort()
 			return
 		}
@@ -57,11 +63,77 @@ func JWTAuth() gin.HandlerFunc {
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 			// Add claims to context
 			c.Set("user_id", claims["user_id"])
+			c.Set("role", claims["role"])
+
+			// Identify the principal in request logs
+			ctx := c.Request.Context()
+			logger := logging.FromContext(ctx).With("user_id", claims["user_id"])
+			c.Request = c.Request.WithContext(logging.WithContext(ctx, logger))
 			c.Next()
 		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			c.JSON(http.StatusUnauthorized, responses.NewError(c.Request.Context(), "Invalid token claims"))
+			c.Abort()
+			return
+		}
+	}
+}
+
+// parseToken parses and verifies an HMAC signed JWT
+func parseToken(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Validate signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return loadJWTSecret(), nil
+	})
+}
+
+// bearerClaims returns the claims of a valid bearer token on the request,
+// or nil when there is none
+func bearerClaims(r *http.Request) jwt.MapClaims {
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || loadJWTSecret() == nil {
+		return nil
+	}
+	token, err := parseToken(tokenString)
+	if err != nil || !token.Valid {
+		return nil
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	return claims
+}
+
+// RequireRole middleware allows only tokens whose role claim matches role.
+// It must run after JWTAuth.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != role {
+			c.JSON(http.StatusForbidden, responses.NewError(c.Request.Context(), "Insufficient permissions"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// StaticToken middleware allows only requests carrying token as a bearer
+// credential, identifying them as the admin principal. The comparison takes
+// constant time.
+func StaticToken(token string) gin.HandlerFunc {
+	want := []byte(token)
+	return func(c *gin.Context) {
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || len(want) == 0 || subtle.ConstantTimeCompare([]byte(got), want) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.JSON(http.StatusUnauthorized, responses.NewError(c.Request.Context(), "Invalid admin token"))
 			c.Abort()
 			return
 		}
+
+		c.Set("user_id", "admin")
+		c.Set("role", "admin")
+		c.Next()
 	}
 }
@@ -3,115 +3,645 @@ package middleware
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 
 	"api-gateway/config"
+	"api-gateway/internal/requestid"
+	utilhttp "api-gateway/internal/utils/http"
 )
 
-var (
-	redisClient *redis.Client
-	cacheCfg    *config.CacheConfig
+// cacheTimeout bounds every store round trip made while serving a request
+const cacheTimeout = 100 * time.Millisecond
+
+// cacheRefreshTimeout bounds a background revalidation of a stale entry
+const cacheRefreshTimeout = 30 * time.Second
+
+// Store key prefixes for cached entries, their Vary field lists and the
+// sets indexing entries by path and surrogate key
+const (
+	cacheEntryPrefix = "cache:entry:"
+	cacheVaryPrefix  = "cache:vary:"
+	cachePathPrefix  = "cache:path:"
+	cacheTagPrefix   = "cache:tag:"
 )
 
-// InitRedis initializes the Redis client with the given address and cache config
-func InitRedis(addr string, cfg *config.CacheConfig) error {
-	cacheCfg = cfg
-	redisClient = redis.NewClient(&redis.Options{
-		Addr: addr,
-	})
+type cacheRefreshKey struct{}
+
+// unstoredHeaders are response headers that describe a single hop or a single
+// delivery and must not be replayed from cache
+var unstoredHeaders = map[string]bool{
+	"Age":               true,
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Set-Cookie":        true,
+	"Te":                true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"X-Cache":           true,
+}
+
+// ResponseCache is an RFC 9111 shared cache for GET responses kept in a
+// CacheStore, optionally fronted by an in-process LRU cache
+type ResponseCache struct {
+	cfg   *config.CacheConfig
+	store CacheStore // nil disables storage
+	l1    *lruCache  // In-process cache in front of the store, nil if disabled
+	keys  *cacheKeys
+	id    string // Identifies this cache in invalidation messages
+
+	inflight       singleflight.Group // Coalesces concurrent misses per key
+	refreshing     sync.Map           // Keys with a background refresh running
+	refreshHandler http.Handler
+
+	refreshMu sync.Mutex
+	refreshes sync.WaitGroup // Running background refreshes, waited on by Close
+	closed    bool           // No refreshes start once set
+
+	results map[string]*atomic.Uint64 // Requests by X-Cache value, fixed at creation
+}
+
+// cacheResults are the X-Cache values set by the cache
+var cacheResults = []string{"HIT", "STALE", "MISS", "REVALIDATED", "BYPASS"}
+
+// CacheStats summarizes the activity and contents of the response cache
+type CacheStats struct {
+	Store     string
+	Results   map[string]uint64 // GET requests by X-Cache value
+	L1Entries int               // Items in the in-process cache
+	L1Bytes   int
+}
+
+// NewResponseCache creates a cache keeping entries in store. A nil store
+// disables storage while still generating ETags and answering conditional
+// requests.
+func NewResponseCache(cfg *config.CacheConfig, store CacheStore) *ResponseCache {
+	rc := &ResponseCache{
+		cfg:     cfg,
+		store:   store,
+		keys:    newCacheKeys(cfg),
+		id:      newNodeID(),
+		results: make(map[string]*atomic.Uint64, len(cacheResults)),
+	}
+	for _, result := range cacheResults {
+		rc.results[result] = new(atomic.Uint64)
+	}
+	// An in-process store needs no in-process cache in front of it
+	if _, inProcess := store.(*MemoryStore); !inProcess && store != nil && cfg.L1MaxBytes > 0 && cfg.L1TTL > 0 {
+		rc.l1 = newLRUCache(cfg.L1MaxBytes, time.Duration(cfg.L1TTL)*time.Second)
+	}
+	return rc
+}
+
+// SetRefreshHandler sets the handler that background refreshes of stale
+// entries are replayed through, normally the server's router
+func (rc *ResponseCache) SetRefreshHandler(h http.Handler) {
+	rc.refreshHandler = h
+}
+
+// Stats returns the request counts by cache result and the size of the
+// in-process cache
+func (rc *ResponseCache) Stats() CacheStats {
+	stats := CacheStats{
+		Store:   rc.cfg.Store,
+		Results: make(map[string]uint64, len(rc.results)),
+	}
+	if rc.store == nil {
+		stats.Store = "none"
+	}
+	for result, n := range rc.results {
+		stats.Results[result] = n.Load()
+	}
+	if rc.l1 != nil {
+		stats.L1Entries, stats.L1Bytes = rc.l1.len()
+	}
+	return stats
+}
+
+// countResult counts the cache result of a served GET request
+func (rc *ResponseCache) countResult(c *gin.Context) {
+	if n, ok := rc.results[c.Writer.Header().Get("X-Cache")]; ok {
+		n.Add(1)
+	}
+}
+
+// Close waits for running background refreshes and releases the
+// underlying store
+func (rc *ResponseCache) Close() error {
+	rc.refreshMu.Lock()
+	rc.closed = true
+	rc.refreshMu.Unlock()
+	rc.refreshes.Wait()
+
+	if rc.store == nil {
+		return nil
+	}
+	return rc.store.Close()
+}
 
-	// Test the connection
-	_, err := redisClient.Ping(context.Background()).Result()
-	return err
+// applyFreshness sets the freshness lifetime and stale windows from the
+// response directives, using the configured defaults where absent
+func (rc *ResponseCache) applyFreshness(e *cacheEntry, respCC cacheDirectives, defaultTTL time.Duration) {
+	e.TTL = freshnessLifetime(e.Header, respCC, defaultTTL)
+	e.StaleWhileRevalidate = time.Duration(rc.cfg.StaleWhileRevalidate) * time.Second
+	if swr, ok := respCC.seconds("stale-while-revalidate"); ok {
+		e.StaleWhileRevalidate = swr
+	}
+	e.StaleIfError = time.Duration(rc.cfg.StaleIfError) * time.Second
+	if sie, ok := respCC.seconds("stale-if-error"); ok {
+		e.StaleIfError = sie
+	}
+	e.MustRevalidate = respCC.has("must-revalidate") || respCC.has("proxy-revalidate") || respCC.has("no-cache")
 }
 
-type responseWriter struct {
+// bufferedWriter holds the response until the cache middleware decides
+// whether to send it, a 304, or a stored entry instead. Bodies growing past
+// limit are streamed to the client and not cached.
+type bufferedWriter struct {
 	gin.ResponseWriter
-	body *bytes.Buffer
+	body        bytes.Buffer
+	limit       int // Maximum buffered body size, 0 for no limit
+	passthrough bool
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	if !w.passthrough && w.limit > 0 && w.body.Len()+len(b) > w.limit {
+		w.passthrough = true
+		w.send()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
 }
 
-func (w responseWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
-	return w.ResponseWriter.Write(b)
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
 }
 
-// Cache middleware caches GET requests using Redis
-func Cache() gin.HandlerFunc {
+func (w *bufferedWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.ResponseWriter.Written() || w.body.Len() > 0
+}
+
+func (w *bufferedWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	return w.body.Len()
+}
+
+// Flush stops buffering so streamed responses reach the client immediately
+func (w *bufferedWriter) Flush() {
+	if !w.passthrough {
+		w.passthrough = true
+		w.send()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// send writes the status and buffered body to the underlying writer
+func (w *bufferedWriter) send() {
+	w.ResponseWriter.WriteHeaderNow()
+	w.ResponseWriter.Write(w.body.Bytes())
+	w.body.Reset()
+}
+
+// Middleware caches GET requests following RFC 9111 shared cache semantics
+// and answers conditional requests with 304. Concurrent misses for the same
+// key are coalesced into a single origin request, and stale entries are
+// served while revalidating or on error.
+func (rc *ResponseCache) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Skip caching for non-GET requests
+		// Skip caching for non-GET requests, invalidating after unsafe ones
 		if c.Request.Method != http.MethodGet {
 			c.Next()
+			if rc.store != nil && isUnsafeMethod(c.Request.Method) {
+				rc.invalidateAfterUnsafe(c)
+			}
 			return
 		}
+		defer rc.countResult(c)
 
-		// Skip if Redis client is not initialized
-		if redisClient == nil {
-			c.Next()
+		reqCC := parseCacheControl(c.Request.Header)
+		rule := rc.keys.rule(c.FullPath())
+
+		// Skip storage if no store is configured or the route opted out
+		if rc.store == nil || !rule.enabled || reqCC.has("no-store") {
+			res := rc.fetchFromOrigin(c, rule, "", reqCC, nil, false)
+			if !res.sent {
+				writeCachedResponse(c, res.entry, "BYPASS")
+			}
 			return
 		}
 
-		key := c.Request.URL.String()
+		key := rc.keys.key(rule, c.Request)
+		refresh := isCacheRefresh(c.Request)
 
-		// Try to get from cache
-		if val, err := redisClient.Get(context.Background(), key).Result(); err == nil {
-			var cached struct {
-				Status int         `json:"status"`
-				Header http.Header `json:"header"`
-				Data   string      `json:"data"`
+		if !refresh && !requestAllowsCachedResponse(c.Request, reqCC) {
+			res := rc.fetchFromOrigin(c, rule, key, reqCC, nil, true)
+			if !res.sent {
+				writeCachedResponse(c, res.entry, res.cacheStatus)
 			}
+			return
+		}
 
-			if err := json.Unmarshal([]byte(val), &cached); err == nil {
-				// Set headers from cache
-				for k, v := range cached.Header {
-					for _, vv := range v {
-						c.Writer.Header().Add(k, vv)
-					}
-				}
-				c.Writer.WriteHeader(cached.Status)
-				c.Writer.Write([]byte(cached.Data))
+		// Try to get from cache
+		var stale *cacheEntry
+		if entry := rc.lookup(c.Request.Context(), key, c.Request); entry != nil {
+			now := time.Now()
+			switch {
+			case refresh:
+				stale = entry
+			case entryAcceptable(entry, reqCC, now):
+				writeCachedResponse(c, entry, "HIT")
 				c.Abort()
 				return
+			case !reqCC.has("max-age") && !reqCC.has("min-fresh") && entry.servableStale(now, entry.StaleWhileRevalidate):
+				rc.refreshInBackground(c.Request, key)
+				writeCachedResponse(c, entry, "STALE")
+				c.Abort()
+				return
+			default:
+				stale = entry
 			}
 		}
 
-		// Create a custom ResponseWriter to capture the response
-		w := &responseWriter{
-			ResponseWriter: c.Writer,
-			body:           bytes.NewBuffer(nil),
+		// Coalesce concurrent misses so only one request reaches the origin
+		leader := false
+		v, _, _ := rc.inflight.Do(key, func() (interface{}, error) {
+			leader = true
+			return rc.fetchFromOrigin(c, rule, key, reqCC, stale, true), nil
+		})
+		res := v.(*fetchResult)
+
+		if !leader {
+			if !res.shareableWith(c.Request, rule, reqCC) {
+				res = rc.fetchFromOrigin(c, rule, key, reqCC, stale, true)
+			} else {
+				c.Abort()
+			}
+		}
+		if !res.sent {
+			writeCachedResponse(c, res.entry, res.cacheStatus)
 		}
-		c.Writer = w
-
-		c.Next()
-
-		// Only cache successful responses
-		if c.Writer.Status() >= 200 && c.Writer.Status() < 300 && !c.IsAborted() {
-			cached := struct {
-				Status int         `json:"status"`
-				Header http.Header `json:"header"`
-				Data   string      `json:"data"`
-			}{
-				Status: c.Writer.Status(),
-				Header: w.Header(),
-				Data:   w.body.String(),
+	}
+}
+
+// fetchResult is the outcome of running the handler chain for a request
+type fetchResult struct {
+	entry       *cacheEntry
+	cacheStatus string
+	shareable   bool   // entry may be served to other requests
+	key         string // cache key the entry belongs to
+	variant     string // entry key of the request that produced it
+	sent        bool   // response was already written to the client
+}
+
+// shareableWith reports whether a coalesced result may answer another request
+func (res *fetchResult) shareableWith(r *http.Request, rule *cacheRule, reqCC cacheDirectives) bool {
+	if res.sent || !res.shareable {
+		return false
+	}
+	respCC := parseCacheControl(res.entry.Header)
+	if !responseStorable(r, rule, res.entry.Status, res.entry.Header, reqCC, respCC) {
+		return false
+	}
+	return variantKey(res.key, varyFields(res.entry.Header), r) == res.variant
+}
+
+// fetchFromOrigin runs the remaining handlers with a buffered writer,
+// revalidating stale if given and storing the response when permitted
+func (rc *ResponseCache) fetchFromOrigin(c *gin.Context, rule *cacheRule, key string, reqCC cacheDirectives, stale *cacheEntry, useStore bool) *fetchResult {
+	// Revalidate a stale entry using its validators, with the upstream as
+	// well when the handler calls one through an HTTPSender
+	restoreValidators := func() {}
+	var upstream utilhttp.Validators
+	if stale != nil {
+		restoreValidators = setValidators(c.Request, stale)
+		upstream = stale.Upstream
+	}
+	ctx, rv := utilhttp.WithRevalidation(c.Request.Context(), upstream)
+	c.Request = c.Request.WithContext(ctx)
+
+	// Buffer the response so validators can be computed before sending
+	original := c.Writer
+	w := &bufferedWriter{ResponseWriter: original, limit: rc.cfg.MaxBodyBytes}
+	c.Writer = w
+	defer func() { c.Writer = original }()
+
+	c.Next()
+	restoreValidators()
+
+	if w.passthrough {
+		return &fetchResult{sent: true}
+	}
+	if c.IsAborted() {
+		w.send()
+		return &fetchResult{sent: true}
+	}
+
+	now := time.Now()
+	status := w.Status()
+	header := w.Header()
+	// The request ID belongs to this request, not to the hits replaying it
+	requestIDHeader := requestid.HeaderFromContext(c.Request.Context())
+
+	if stale != nil {
+		fields := varyFields(stale.Header)
+		switch {
+		case status == http.StatusNotModified:
+			refreshed := *stale
+			refreshed.Header = mergeNotModifiedHeader(stale.Header, header, requestIDHeader)
+			refreshed.StoredAt = now
+			if received := rv.Received(); !received.IsZero() {
+				refreshed.Upstream = received
 			}
+			rc.applyFreshness(&refreshed, parseCacheControl(refreshed.Header), rule.ttl)
+			rc.storeEntry(c.Request.Context(), key, c.Request, &refreshed)
+			return &fetchResult{entry: &refreshed, cacheStatus: "REVALIDATED", shareable: true, key: key, variant: variantKey(key, fields, c.Request)}
+
+		case status >= http.StatusInternalServerError && stale.servableStale(now, stale.StaleIfError):
+			// Serve the stale entry instead of the origin error
+			return &fetchResult{entry: stale, cacheStatus: "STALE", shareable: true, key: key, variant: variantKey(key, fields, c.Request)}
+		}
+	}
+
+	if status == http.StatusOK && header.Get("ETag") == "" {
+		header.Set("ETag", generateETag(w.body.Bytes()))
+	}
+
+	res := &fetchResult{
+		entry: &cacheEntry{
+			Status:   status,
+			Header:   storableHeader(header, requestIDHeader),
+			Body:     bytes.Clone(w.body.Bytes()),
+			Upstream: rv.Received(),
+		},
+		cacheStatus: "BYPASS",
+		key:         key,
+	}
+	if !useStore {
+		return res
+	}
+
+	res.cacheStatus = "MISS"
+
+	respCC := parseCacheControl(header)
+	if responseStorable(c.Request, rule, status, header, reqCC, respCC) {
+		if header.Get("Last-Modified") == "" {
+			header.Set("Last-Modified", now.UTC().Format(http.TimeFormat))
+		}
+		res.entry.Header.Set("Last-Modified", header.Get("Last-Modified"))
+		res.entry.StoredAt = now
+		rc.applyFreshness(res.entry, respCC, rule.ttl)
+		rc.storeEntry(c.Request.Context(), key, c.Request, res.entry)
+
+		res.shareable = true
+		res.variant = variantKey(key, varyFields(header), c.Request)
+	}
+	return res
+}
+
+// refreshInBackground replays the request through the engine so a stale
+// entry is revalidated without delaying the client
+func (rc *ResponseCache) refreshInBackground(r *http.Request, key string) {
+	if rc.refreshHandler == nil {
+		return
+	}
+	rc.refreshMu.Lock()
+	defer rc.refreshMu.Unlock()
+	if rc.closed {
+		return
+	}
+	if _, running := rc.refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	rc.refreshes.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.WithoutCancel(r.Context()), cacheRefreshKey{}, true), cacheRefreshTimeout)
+	req := r.Clone(ctx)
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+
+	go func() {
+		defer rc.refreshes.Done()
+		defer rc.refreshing.Delete(key)
+		defer cancel()
+		rc.refreshHandler.ServeHTTP(discardResponseWriter{header: make(http.Header)}, req)
+	}()
+}
+
+// isCacheRefresh reports whether the request is a background cache refresh
+func isCacheRefresh(r *http.Request) bool {
+	refresh, _ := r.Context().Value(cacheRefreshKey{}).(bool)
+	return refresh
+}
+
+// discardResponseWriter drops the response of a background refresh
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header         { return w.header }
+func (w discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardResponseWriter) WriteHeader(int)             {}
+
+// writeCachedResponse writes an entry to the client, answering conditional
+// requests with 304
+func writeCachedResponse(c *gin.Context, entry *cacheEntry, cacheStatus string) {
+	// Set headers from cache
+	for k, v := range entry.Header {
+		c.Writer.Header()[k] = v
+	}
+	if !entry.StoredAt.IsZero() {
+		c.Header("Age", strconv.Itoa(int(entry.age(time.Now()).Seconds())))
+	}
+	c.Header("X-Cache", cacheStatus)
+
+	if entry.Status == http.StatusOK && notModified(c.Request, entry.Header) {
+		writeNotModified(c.Writer)
+		return
+	}
+	c.Writer.WriteHeader(entry.Status)
+	c.Writer.Write(entry.Body)
+}
 
-			// Attempt to cache but don't block on errors
-			if data, err := json.Marshal(cached); err == nil {
-				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
-				defer cancel()
-
-				redisClient.Set(
-					ctx,
-					key,
-					data,
-					time.Duration(cacheCfg.Duration)*time.Second,
-				)
+// storableHeader copies the response headers that may be replayed from
+// cache, leaving out the request ID header
+func storableHeader(header http.Header, requestIDHeader string) http.Header {
+	requestIDHeader = http.CanonicalHeaderKey(requestIDHeader)
+	stored := make(http.Header, len(header))
+	for k, v := range header {
+		if unstoredHeaders[k] || k == requestIDHeader || strings.HasPrefix(k, "Access-Control-") {
+			continue
+		}
+		stored[k] = append([]string(nil), v...)
+	}
+	return stored
+}
+
+// variantKey returns the entry key for the request given the Vary fields
+// of the stored response
+func variantKey(key string, fields []string, r *http.Request) string {
+	if len(fields) == 0 {
+		return cacheEntryPrefix + key
+	}
+
+	h := sha256.New()
+	for _, field := range fields {
+		h.Write([]byte(field))
+		h.Write([]byte{':'})
+		h.Write([]byte(strings.Join(r.Header.Values(field), ",")))
+		h.Write([]byte{'\n'})
+	}
+	return cacheEntryPrefix + key + "#" + hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// lookup fetches the entry matching the request's Vary fields, trying the
+// in-process cache before the store
+func (rc *ResponseCache) lookup(ctx context.Context, key string, r *http.Request) *cacheEntry {
+	if entry, ok := rc.lookupL1(key, r); ok {
+		return entry
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cacheTimeout)
+	defer cancel()
+
+	vals, err := rc.store.Get(ctx, cacheVaryPrefix+key, cacheEntryPrefix+key)
+	if err != nil {
+		return nil
+	}
+
+	var fields []string
+	raw := vals[1]
+	if vals[0] != nil {
+		if err := json.Unmarshal(vals[0], &fields); err != nil {
+			return nil
+		}
+		if len(fields) > 0 {
+			if raw, err = getOne(ctx, rc.store, variantKey(key, fields, r)); err != nil {
+				return nil
 			}
 		}
 	}
+	if raw == nil {
+		return nil
+	}
+
+	entry, err := decodeEntry(raw)
+	if err != nil {
+		return nil
+	}
+	rc.addL1(key, r, entry, fields)
+	return entry
+}
+
+// lookupL1 fetches the entry for the request from the in-process cache
+func (rc *ResponseCache) lookupL1(key string, r *http.Request) (*cacheEntry, bool) {
+	if rc.l1 == nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	var fields []string
+	if vary := rc.l1.get(cacheVaryPrefix+key, now); vary != nil {
+		fields = vary.fields
+	}
+	if item := rc.l1.get(variantKey(key, fields, r), now); item != nil {
+		return item.entry, true
+	}
+	return nil, false
+}
+
+// addL1 copies an entry and its Vary fields into the in-process cache
+func (rc *ResponseCache) addL1(key string, r *http.Request, entry *cacheEntry, fields []string) {
+	if rc.l1 == nil {
+		return
+	}
+
+	now := time.Now()
+	lifetime := rc.entryExpiration(entry) - entry.age(now)
+	if lifetime <= 0 {
+		return
+	}
+
+	tags := cacheTags(entry.Header)
+	uri, _ := rc.keys.uri(cacheEntryPrefix + key)
+	if len(fields) > 0 {
+		rc.l1.add(&l1Item{key: cacheVaryPrefix + key, uri: uri, path: r.URL.Path, fields: fields, size: 64}, lifetime, now)
+	}
+	rc.l1.add(&l1Item{
+		key:   variantKey(key, fields, r),
+		uri:   uri,
+		path:  r.URL.Path,
+		tags:  tags,
+		entry: entry,
+		size:  entrySize(entry),
+	}, lifetime, now)
+}
+
+// entryExpiration returns how long an entry is retained after being stored
+func (rc *ResponseCache) entryExpiration(entry *cacheEntry) time.Duration {
+	// Keep expired entries around so they can be revalidated or served stale
+	return entry.TTL + max(time.Duration(rc.cfg.StaleTTL)*time.Second, entry.StaleWhileRevalidate, entry.StaleIfError)
+}
+
+// storeEntry saves the entry under the key for the request's variant
+func (rc *ResponseCache) storeEntry(ctx context.Context, key string, r *http.Request, entry *cacheEntry) {
+	expiration := rc.entryExpiration(entry)
+	if expiration <= 0 {
+		return
+	}
+
+	// Attempt to cache but don't block on errors
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheTimeout)
+	defer cancel()
+
+	// The vary record is always written so a response that stopped varying
+	// replaces the variant list of an earlier one
+	fields := varyFields(entry.Header)
+	vary, _ := json.Marshal(fields)
+	if fields == nil {
+		vary = []byte("[]")
+	}
+	entryKey := variantKey(key, fields, r)
+
+	// Index the entry by path and surrogate keys for invalidation
+	pathIndex := cachePathPrefix + r.URL.Path
+	entryIndexes := []string{pathIndex}
+	for _, tag := range cacheTags(entry.Header) {
+		entryIndexes = append(entryIndexes, cacheTagPrefix+tag)
+	}
+
+	err := rc.store.Set(ctx,
+		CacheItem{Key: cacheVaryPrefix + key, Value: vary, TTL: expiration, Indexes: []string{pathIndex}},
+		CacheItem{Key: entryKey, Value: encodeEntry(entry, rc.cfg.CompressionMinBytes), TTL: expiration, Indexes: entryIndexes},
+	)
+	if err != nil {
+		return
+	}
+
+	// Replace the in-process copies here and drop them on other replicas,
+	// the vary record too as it may now list other fields
+	rc.broadcast(ctx, invalidateEntry, cacheVaryPrefix+key)
+	rc.broadcast(ctx, invalidateEntry, entryKey)
+	rc.addL1(key, r, entry, fields)
 }
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// generateETag returns a strong entity tag derived from the response body
+func generateETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+}
+
+// etagMatches performs the weak comparison used by If-None-Match
+func etagMatches(list, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since against the
+// response validators as described in RFC 9110 section 13.2.2
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Values("If-None-Match"); len(inm) > 0 {
+		return etagMatches(strings.Join(inm, ","), header.Get("ETag"))
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(ims)
+}
+
+// writeNotModified sends a 304 response without representation metadata
+func writeNotModified(w gin.ResponseWriter) {
+	header := w.Header()
+	for k := range header {
+		if strings.HasPrefix(k, "Content-") && k != "Content-Location" {
+			delete(header, k)
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+	w.WriteHeaderNow()
+}
+
+// setValidators replaces the request's conditional headers with the
+// validators of a stored entry and returns a function restoring the originals
+func setValidators(r *http.Request, entry *cacheEntry) func() {
+	saved := map[string][]string{
+		"If-None-Match":     r.Header.Values("If-None-Match"),
+		"If-Modified-Since": r.Header.Values("If-Modified-Since"),
+	}
+
+	r.Header.Del("If-None-Match")
+	r.Header.Del("If-Modified-Since")
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		r.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	return func() {
+		for k, v := range saved {
+			if len(v) == 0 {
+				r.Header.Del(k)
+			} else {
+				r.Header[k] = v
+			}
+		}
+	}
+}
+
+// mergeNotModifiedHeader updates stored headers with those of a 304 response
+func mergeNotModifiedHeader(stored, fresh http.Header, requestIDHeader string) http.Header {
+	merged := stored.Clone()
+	for k, v := range storableHeader(fresh, requestIDHeader) {
+		if strings.HasPrefix(k, "Content-") {
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
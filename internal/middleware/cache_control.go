@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheDirectives holds parsed Cache-Control directives keyed by lower-case name
+type cacheDirectives map[string]string
+
+// parseCacheControl parses all Cache-Control values of the given header
+func parseCacheControl(h http.Header) cacheDirectives {
+	directives := make(cacheDirectives)
+	for _, value := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, arg, _ := strings.Cut(part, "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if _, exists := directives[name]; exists {
+				continue // RFC 9111: the first occurrence wins
+			}
+			directives[name] = strings.Trim(strings.TrimSpace(arg), `"`)
+		}
+	}
+	return directives
+}
+
+// has reports whether the directive is present
+func (d cacheDirectives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// seconds returns the delta-seconds argument of a directive
+func (d cacheDirectives) seconds(name string) (time.Duration, bool) {
+	arg, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// requestAllowsCachedResponse reports whether the request permits answering
+// from cache without contacting the origin
+func requestAllowsCachedResponse(r *http.Request, reqCC cacheDirectives) bool {
+	if reqCC.has("no-cache") {
+		return false
+	}
+	if len(reqCC) == 0 && strings.Contains(strings.ToLower(r.Header.Get("Pragma")), "no-cache") {
+		return false
+	}
+	return true
+}
+
+// entryAcceptable checks an entry against the request's freshness requirements
+func entryAcceptable(entry *cacheEntry, reqCC cacheDirectives, now time.Time) bool {
+	age := entry.age(now)
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok && entry.TTL-age < minFresh {
+		return false
+	}
+	return age < entry.TTL
+}
+
+// responseStorable reports whether a response may be stored in the shared
+// cache under rule
+func responseStorable(r *http.Request, rule *cacheRule, status int, header http.Header, reqCC, respCC cacheDirectives) bool {
+	// Only cache successful responses
+	if status < 200 || status >= 300 {
+		return false
+	}
+	if reqCC.has("no-store") || respCC.has("no-store") || respCC.has("private") {
+		return false
+	}
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, field := range varyFields(header) {
+		if field == "*" {
+			return false
+		}
+	}
+
+	// Responses to authenticated requests are only shared when explicitly
+	// allowed, or kept apart by the principal claims of the key
+	if r.Header.Get("Authorization") != "" {
+		return respCC.has("public") || respCC.has("s-maxage") || respCC.has("must-revalidate") || rule.principalKeyed(r)
+	}
+
+	return true
+}
+
+// freshnessLifetime derives how long a response stays fresh, falling back to def
+func freshnessLifetime(header http.Header, respCC cacheDirectives, def time.Duration) time.Duration {
+	// no-cache responses may be stored but must be revalidated before reuse
+	if respCC.has("no-cache") {
+		return 0
+	}
+	if sMaxAge, ok := respCC.seconds("s-maxage"); ok {
+		return sMaxAge
+	}
+	if maxAge, ok := respCC.seconds("max-age"); ok {
+		return maxAge
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		exp, err := http.ParseTime(expires)
+		if err != nil {
+			return 0 // invalid Expires means already expired
+		}
+		date := time.Now()
+		if d, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = d
+		}
+		if lifetime := exp.Sub(date); lifetime > 0 {
+			return lifetime
+		}
+		return 0
+	}
+	return def
+}
+
+// varyFields returns the canonical, sorted header names listed in Vary
+func varyFields(header http.Header) []string {
+	var fields []string
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if field != "*" {
+				field = http.CanonicalHeaderKey(field)
+			}
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return slices.Compact(fields)
+}
@@ -0,0 +1,60 @@
+package middleware_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"api-gateway/internal/middleware"
+)
+
+func TestResponseCache_CacheControl(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	bearer := http.Header{"Authorization": {"Bearer token"}}
+	for _, tt := range []struct {
+		name          string
+		cacheControl  string // Sent by the origin
+		vary          string // Sent by the origin
+		first, second http.Header
+		want          string // X-Cache of the second request
+	}{
+		{name: "max-age", cacheControl: "max-age=60", want: "HIT"},
+		{name: "request no-store", first: http.Header{"Cache-Control": {"no-store"}}, want: "MISS"},
+		{name: "response no-store", cacheControl: "no-store", want: "MISS"},
+		{name: "private", cacheControl: "private, max-age=60", want: "MISS"},
+		{name: "vary match", cacheControl: "max-age=60", vary: "Accept-Language",
+			first: http.Header{"Accept-Language": {"en"}}, second: http.Header{"Accept-Language": {"en"}}, want: "HIT"},
+		{name: "vary mismatch", cacheControl: "max-age=60", vary: "Accept-Language",
+			first: http.Header{"Accept-Language": {"en"}}, second: http.Header{"Accept-Language": {"fr"}}, want: "MISS"},
+		{name: "vary star", cacheControl: "max-age=60", vary: "*", want: "MISS"},
+		{name: "authorization", cacheControl: "max-age=60", first: bearer, second: bearer, want: "MISS"},
+		{name: "authorization public", cacheControl: "public, max-age=60", first: bearer, second: bearer, want: "HIT"},
+		{name: "authorization s-maxage", cacheControl: "s-maxage=60", first: bearer, second: bearer, want: "HIT"},
+		{name: "s-maxage over max-age", cacheControl: "max-age=0, s-maxage=60", want: "HIT"},
+		{name: "s-maxage zero", cacheControl: "max-age=60, s-maxage=0", want: "MISS"},
+		{name: "no-cache", cacheControl: "no-cache", want: "MISS"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testCacheConfig()
+			cfg.StaleWhileRevalidate = 0
+			rc := middleware.NewResponseCache(cfg, middleware.NewMemoryStore(0))
+			r := gin.New()
+			r.Use(rc.Middleware())
+			r.GET("/items", func(c *gin.Context) {
+				if tt.cacheControl != "" {
+					c.Header("Cache-Control", tt.cacheControl)
+				}
+				if tt.vary != "" {
+					c.Header("Vary", tt.vary)
+				}
+				c.String(http.StatusOK, "items")
+			})
+
+			serve(r, http.MethodGet, "/items", tt.first)
+			assert.Equal(t, tt.want, serve(r, http.MethodGet, "/items", tt.second).Header().Get("X-Cache"))
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	utilhttp "api-gateway/internal/utils/http"
+)
+
+// Binary entry format: magic, version, flags, then varint encoded fields,
+// headers, the length-prefixed body and the upstream validators
+const (
+	entryMagic   = "GWC"
+	entryVersion = 1
+
+	entryFlagGzip           = 1 << 0
+	entryFlagMustRevalidate = 1 << 1
+)
+
+// errInvalidEntry is returned when stored bytes cannot be decoded
+var errInvalidEntry = errors.New("invalid cache entry")
+
+// cacheEntry is a stored response
+type cacheEntry struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+	TTL      time.Duration // Freshness lifetime
+
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	MustRevalidate       bool
+
+	// Validators of the upstream response the entry was built from, sent
+	// to the upstream when the entry is revalidated
+	Upstream utilhttp.Validators
+}
+
+// age returns how long ago the entry was stored
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	if age := now.Sub(e.StoredAt); age > 0 {
+		return age
+	}
+	return 0
+}
+
+// servableStale reports whether the entry is within the given stale window
+func (e *cacheEntry) servableStale(now time.Time, window time.Duration) bool {
+	return !e.MustRevalidate && e.age(now) < e.TTL+window
+}
+
+// encodeEntry serializes an entry, gzip compressing bodies of at least
+// compressMin bytes when that makes them smaller. A compressMin of zero
+// disables compression.
+func encodeEntry(e *cacheEntry, compressMin int) []byte {
+	var flags byte
+	if e.MustRevalidate {
+		flags |= entryFlagMustRevalidate
+	}
+
+	body := e.Body
+	if compressMin > 0 && len(body) >= compressMin {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		zw.Write(body)
+		if zw.Close() == nil && zbuf.Len() < len(body) {
+			body = zbuf.Bytes()
+			flags |= entryFlagGzip
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(body) + 256)
+	buf.WriteString(entryMagic)
+	buf.WriteByte(entryVersion)
+	buf.WriteByte(flags)
+	buf.Write(binary.AppendUvarint(nil, uint64(e.Status)))
+	buf.Write(binary.AppendVarint(nil, e.StoredAt.UnixNano()))
+	buf.Write(binary.AppendVarint(nil, int64(e.TTL)))
+	buf.Write(binary.AppendVarint(nil, int64(e.StaleWhileRevalidate)))
+	buf.Write(binary.AppendVarint(nil, int64(e.StaleIfError)))
+
+	buf.Write(binary.AppendUvarint(nil, uint64(len(e.Header))))
+	for k, values := range e.Header {
+		writeBytes(&buf, []byte(k))
+		buf.Write(binary.AppendUvarint(nil, uint64(len(values))))
+		for _, v := range values {
+			writeBytes(&buf, []byte(v))
+		}
+	}
+
+	writeBytes(&buf, body)
+	writeBytes(&buf, []byte(e.Upstream.ETag))
+	writeBytes(&buf, []byte(e.Upstream.LastModified))
+	return buf.Bytes()
+}
+
+// decodeEntry parses bytes produced by encodeEntry
+func decodeEntry(data []byte) (*cacheEntry, error) {
+	if len(data) < len(entryMagic)+2 || string(data[:len(entryMagic)]) != entryMagic || data[len(entryMagic)] != entryVersion {
+		return nil, errInvalidEntry
+	}
+	flags := data[len(entryMagic)+1]
+	r := bytes.NewReader(data[len(entryMagic)+2:])
+
+	status, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errInvalidEntry
+	}
+	var fields [4]int64
+	for i := range fields {
+		if fields[i], err = binary.ReadVarint(r); err != nil {
+			return nil, errInvalidEntry
+		}
+	}
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(r.Len()) {
+		return nil, errInvalidEntry
+	}
+	header := make(http.Header, count)
+	for i := uint64(0); i < count; i++ {
+		k, err := readBytes(r)
+		if err != nil {
+			return nil, errInvalidEntry
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > uint64(r.Len()) {
+			return nil, errInvalidEntry
+		}
+		values := make([]string, n)
+		for j := range values {
+			v, err := readBytes(r)
+			if err != nil {
+				return nil, errInvalidEntry
+			}
+			values[j] = string(v)
+		}
+		header[string(k)] = values
+	}
+
+	body, err := readBytes(r)
+	if err != nil {
+		return nil, errInvalidEntry
+	}
+	etag, err := readBytes(r)
+	if err != nil {
+		return nil, errInvalidEntry
+	}
+	lastModified, err := readBytes(r)
+	if err != nil {
+		return nil, errInvalidEntry
+	}
+	if flags&entryFlagGzip != 0 {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, errInvalidEntry
+		}
+		if body, err = io.ReadAll(zr); err != nil {
+			return nil, errInvalidEntry
+		}
+	}
+
+	return &cacheEntry{
+		Status:               int(status),
+		Header:               header,
+		Body:                 body,
+		StoredAt:             time.Unix(0, fields[0]),
+		TTL:                  time.Duration(fields[1]),
+		StaleWhileRevalidate: time.Duration(fields[2]),
+		StaleIfError:         time.Duration(fields[3]),
+		MustRevalidate:       flags&entryFlagMustRevalidate != 0,
+		Upstream:             utilhttp.Validators{ETag: string(etag), LastModified: string(lastModified)},
+	}, nil
+}
+
+// writeBytes writes a uvarint length followed by b
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	buf.Write(binary.AppendUvarint(nil, uint64(len(b))))
+	buf.Write(b)
+}
+
+// byteReader is satisfied by bytes.Reader and bufio.Reader
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readBytes reads a value written by writeBytes
+func readBytes(r byteReader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if br, ok := r.(*bytes.Reader); ok && n > uint64(br.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return readN(r, int(n))
+}
+
+// readN reads exactly n bytes
+func readN(r byteReader, n int) ([]byte, error) {
+	if n > 1<<30 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrCacheDisabled is returned by purge operations when no cache store is configured
+var ErrCacheDisabled = errors.New("cache is not configured")
+
+// isUnsafeMethod reports whether the method may change resource state
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+// cacheTags returns the surrogate keys a response is tagged with, taken from
+// the space separated Surrogate-Key and comma separated Cache-Tag headers
+func cacheTags(header http.Header) []string {
+	var tags []string
+	for _, value := range header.Values("Surrogate-Key") {
+		tags = append(tags, strings.Fields(value)...)
+	}
+	for _, value := range header.Values("Cache-Tag") {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// invalidateAfterUnsafe evicts entries related to a successful unsafe
+// request as described in RFC 9111 section 4.4: the target URI, its parent
+// collection, any Location or Content-Location on the same origin, and the
+// surrogate keys named by the response
+func (rc *ResponseCache) invalidateAfterUnsafe(c *gin.Context) {
+	status := c.Writer.Status()
+	if status < 200 || status >= 400 {
+		return
+	}
+
+	paths := []string{c.Request.URL.Path}
+	if parent := path.Dir(strings.TrimSuffix(c.Request.URL.Path, "/")); parent != "/" && parent != "." {
+		paths = append(paths, parent)
+	}
+	for _, name := range []string{"Location", "Content-Location"} {
+		if loc := c.Writer.Header().Get(name); loc != "" {
+			if u, err := c.Request.URL.Parse(loc); err == nil && (u.Host == "" || u.Host == c.Request.Host) {
+				paths = append(paths, u.Path)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), cacheTimeout)
+	defer cancel()
+
+	for _, p := range paths {
+		rc.store.PurgeIndex(ctx, cachePathPrefix+p, nil)
+		rc.broadcast(ctx, invalidatePath, p)
+	}
+	for _, tag := range cacheTags(c.Writer.Header()) {
+		rc.store.PurgeIndex(ctx, cacheTagPrefix+tag, nil)
+		rc.broadcast(ctx, invalidateTag, tag)
+	}
+}
+
+// PurgeKey removes every variant cached for a request URI such as
+// "/api/users?page=2", including those keyed by headers or principal
+// claims. The query is normalized like a request to a route without rules.
+// A key without a query only matches that exact URI; use PurgePrefix to drop
+// all query strings of a path.
+func (rc *ResponseCache) PurgeKey(ctx context.Context, key string) (int64, error) {
+	if rc.store == nil {
+		return 0, ErrCacheDisabled
+	}
+
+	u, err := url.Parse(key)
+	if err != nil {
+		return 0, err
+	}
+
+	uri := u.EscapedPath()
+	if query := rc.keys.fallback.query(u.RawQuery); query != "" {
+		uri += "?" + query
+	}
+
+	// Purge the store first so replicas evicting their in-process cache
+	// cannot refill it from the store
+	n, err := rc.store.PurgeIndex(ctx, cachePathPrefix+u.Path, func(k string) bool {
+		stored, ok := rc.keys.uri(k)
+		return ok && stored == uri
+	})
+	rc.broadcast(ctx, invalidateKey, uri)
+	return n, err
+}
+
+// PurgePrefix removes every entry whose path starts with prefix
+func (rc *ResponseCache) PurgePrefix(ctx context.Context, prefix string) (int64, error) {
+	if rc.store == nil {
+		return 0, ErrCacheDisabled
+	}
+
+	n, err := rc.store.PurgeIndexPrefix(ctx, cachePathPrefix+prefix)
+	rc.broadcast(ctx, invalidatePrefix, prefix)
+	return n, err
+}
+
+// PurgeTag removes every entry tagged with the given surrogate key
+func (rc *ResponseCache) PurgeTag(ctx context.Context, tag string) (int64, error) {
+	if rc.store == nil {
+		return 0, ErrCacheDisabled
+	}
+
+	n, err := rc.store.PurgeIndex(ctx, cacheTagPrefix+tag, nil)
+	rc.broadcast(ctx, invalidateTag, tag)
+	return n, err
+}
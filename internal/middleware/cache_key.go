@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"api-gateway/config"
+)
+
+// cacheKeySeparator ends the URI part of a key when request headers or
+// principal claims are added. It is escaped in the URI part.
+const cacheKeySeparator = "|"
+
+// cacheRule decides how requests to a route are keyed and stored
+type cacheRule struct {
+	enabled   bool
+	ttl       time.Duration // Default freshness lifetime
+	include   map[string]bool
+	ignore    []string
+	sortQuery bool
+	headers   []string
+	principal []string
+}
+
+// cacheKeys builds cache keys from the configured per-route rules
+type cacheKeys struct {
+	prefix   string
+	fallback *cacheRule
+	routes   map[string]*cacheRule
+}
+
+// newCacheKeys compiles the route rules of the cache config
+func newCacheKeys(cfg *config.CacheConfig) *cacheKeys {
+	k := &cacheKeys{
+		fallback: &cacheRule{
+			enabled:   true,
+			ttl:       time.Duration(cfg.Duration) * time.Second,
+			ignore:    cfg.IgnoreQuery,
+			sortQuery: true,
+		},
+		routes: make(map[string]*cacheRule, len(cfg.Routes)),
+	}
+	for _, part := range []string{cfg.Namespace, cfg.KeyVersion} {
+		if part != "" {
+			k.prefix += part + ":"
+		}
+	}
+
+	for _, route := range cfg.Routes {
+		rule := &cacheRule{
+			enabled:   !route.Disabled,
+			ttl:       k.fallback.ttl,
+			ignore:    append(append([]string(nil), cfg.IgnoreQuery...), route.QueryIgnore...),
+			sortQuery: !route.KeepQueryOrder,
+			principal: route.Principal,
+		}
+		if route.TTL > 0 {
+			rule.ttl = time.Duration(route.TTL) * time.Second
+		}
+		if len(route.QueryInclude) > 0 {
+			rule.include = make(map[string]bool, len(route.QueryInclude))
+			for _, name := range route.QueryInclude {
+				rule.include[name] = true
+			}
+		}
+		for _, name := range route.Headers {
+			rule.headers = append(rule.headers, http.CanonicalHeaderKey(name))
+		}
+		k.routes[route.Route] = rule
+	}
+	return k
+}
+
+// rule returns the rule for a Gin route pattern
+func (k *cacheKeys) rule(route string) *cacheRule {
+	if rule, ok := k.routes[route]; ok {
+		return rule
+	}
+	return k.fallback
+}
+
+// key returns the cache key of a request under rule
+func (k *cacheKeys) key(rule *cacheRule, r *http.Request) string {
+	uri := r.URL.EscapedPath()
+	if query := rule.query(r.URL.RawQuery); query != "" {
+		uri += "?" + query
+	}
+
+	if len(rule.headers) == 0 && len(rule.principal) == 0 {
+		return k.prefix + uri
+	}
+
+	h := sha256.New()
+	for _, name := range rule.headers {
+		fmt.Fprintf(h, "h:%s:%s\n", name, strings.Join(r.Header.Values(name), ","))
+	}
+	if len(rule.principal) > 0 {
+		claims := bearerClaims(r)
+		for _, name := range rule.principal {
+			fmt.Fprintf(h, "p:%s:%v\n", name, claims[name])
+		}
+	}
+	return k.prefix + uri + cacheKeySeparator + hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// principalKeyed reports whether the key of r holds every principal claim
+// of the rule, read from a valid bearer token, so responses to the
+// authenticated request can be stored for that principal only
+func (rule *cacheRule) principalKeyed(r *http.Request) bool {
+	if len(rule.principal) == 0 {
+		return false
+	}
+	claims := bearerClaims(r)
+	for _, name := range rule.principal {
+		if claims[name] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// uri returns the request URI part of a stored key, or false when the key
+// belongs to another namespace or version
+func (k *cacheKeys) uri(storeKey string) (string, bool) {
+	for _, prefix := range []string{cacheEntryPrefix, cacheVaryPrefix} {
+		if rest, ok := strings.CutPrefix(storeKey, prefix); ok {
+			rest, ok = strings.CutPrefix(rest, k.prefix)
+			if !ok {
+				return "", false
+			}
+			if i := strings.IndexAny(rest, cacheKeySeparator+"#"); i >= 0 {
+				rest = rest[:i]
+			}
+			return rest, true
+		}
+	}
+	return "", false
+}
+
+// query filters and orders the query parameters that are part of the key
+func (rule *cacheRule) query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if rule.include != nil && !rule.include[name] {
+			continue
+		}
+		if matchesAny(name, rule.ignore) {
+			continue
+		}
+		params = append(params, strings.ReplaceAll(param, cacheKeySeparator, "%7C"))
+	}
+
+	if rule.sortQuery {
+		// Values of a repeated parameter keep their relative order
+		sort.SliceStable(params, func(i, j int) bool {
+			ni, _, _ := strings.Cut(params[i], "=")
+			nj, _, _ := strings.Cut(params[j], "=")
+			return ni < nj
+		})
+	}
+	return strings.Join(params, "&")
+}
+
+// matchesAny reports whether name equals a pattern or starts with the
+// prefix of a pattern ending in *
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Invalidation scopes carried in broadcast messages
+const (
+	invalidateEntry  = "entry"  // A single stored variant or vary record
+	invalidateKey    = "key"    // Every variant of a request URI
+	invalidatePath   = "path"   // Every URI with the given path
+	invalidatePrefix = "prefix" // Every path starting with the value
+	invalidateTag    = "tag"    // Every entry with the surrogate key
+)
+
+// newNodeID returns a random identifier for the origin of invalidation
+// messages
+func newNodeID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// l1Item is an entry held in the in-process cache
+type l1Item struct {
+	key     string
+	uri     string
+	path    string
+	tags    []string
+	entry   *cacheEntry
+	fields  []string // Vary fields when the item is a vary record
+	size    int
+	expires time.Time
+}
+
+// lruCache is a size-bounded, least recently used in-process cache placed
+// in front of the cache store. Items are immutable once added.
+type lruCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	ttl      time.Duration
+	size     int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+// newLRUCache creates an in-process cache holding at most maxBytes
+func newLRUCache(maxBytes int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the live item for key, if any
+func (l *lruCache) get(key string, now time.Time) *l1Item {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+	item := el.Value.(*l1Item)
+	if now.After(item.expires) {
+		l.removeElement(el)
+		return nil
+	}
+	l.ll.MoveToFront(el)
+	return item
+}
+
+// add stores an item for at most the cache TTL or the given lifetime
+func (l *lruCache) add(item *l1Item, lifetime time.Duration, now time.Time) {
+	if item.size > l.maxBytes {
+		return
+	}
+	item.expires = now.Add(min(l.ttl, lifetime))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[item.key]; ok {
+		l.removeElement(el)
+	}
+	l.items[item.key] = l.ll.PushFront(item)
+	l.size += item.size
+
+	for l.size > l.maxBytes {
+		l.removeElement(l.ll.Back())
+	}
+}
+
+// removeIf evicts every item accepted by match
+func (l *lruCache) removeIf(match func(item *l1Item) bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for el := l.ll.Front(); el != nil; {
+		next := el.Next()
+		if match(el.Value.(*l1Item)) {
+			l.removeElement(el)
+		}
+		el = next
+	}
+}
+
+// remove evicts the item stored under key
+func (l *lruCache) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		l.removeElement(el)
+	}
+}
+
+// len returns the number of items and their estimated size
+func (l *lruCache) len() (int, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len(), l.size
+}
+
+func (l *lruCache) removeElement(el *list.Element) {
+	item := l.ll.Remove(el).(*l1Item)
+	delete(l.items, item.key)
+	l.size -= item.size
+}
+
+// entrySize estimates the memory held by an entry
+func entrySize(entry *cacheEntry) int {
+	size := len(entry.Body) + 128
+	for k, v := range entry.Header {
+		size += len(k)
+		for _, vv := range v {
+			size += len(vv)
+		}
+	}
+	return size
+}
+
+// invalidation is a message broadcast to evict entries on every replica
+type invalidation struct {
+	Scope  string `json:"scope"`
+	Value  string `json:"value"`
+	Origin string `json:"origin"`
+}
+
+// evictLocal removes matching entries from the in-process cache
+func (rc *ResponseCache) evictLocal(scope, value string) {
+	if rc.l1 == nil {
+		return
+	}
+
+	switch scope {
+	case invalidateEntry:
+		rc.l1.remove(value)
+	case invalidateKey:
+		rc.l1.removeIf(func(item *l1Item) bool { return item.uri == value })
+	case invalidatePath:
+		rc.l1.removeIf(func(item *l1Item) bool { return item.path == value })
+	case invalidatePrefix:
+		rc.l1.removeIf(func(item *l1Item) bool { return strings.HasPrefix(item.path, value) })
+	case invalidateTag:
+		rc.l1.removeIf(func(item *l1Item) bool {
+			for _, tag := range item.tags {
+				if tag == value {
+					return true
+				}
+			}
+			return false
+		})
+	}
+}
+
+// broadcast evicts entries locally and, when the store is shared, asks
+// other replicas to do the same
+func (rc *ResponseCache) broadcast(ctx context.Context, scope, value string) {
+	if rc.l1 == nil {
+		return
+	}
+	rc.evictLocal(scope, value)
+
+	if b, ok := rc.store.(CacheBroadcaster); ok {
+		msg, _ := json.Marshal(invalidation{Scope: scope, Value: value, Origin: rc.id})
+		b.Publish(ctx, msg)
+	}
+}
+
+// Listen applies invalidations broadcast by other replicas to the
+// in-process cache until ctx is cancelled. It returns immediately when the
+// store cannot broadcast or the in-process cache is disabled.
+func (rc *ResponseCache) Listen(ctx context.Context) {
+	b, ok := rc.store.(CacheBroadcaster)
+	if !ok || rc.l1 == nil {
+		return
+	}
+
+	b.Subscribe(ctx, func(msg []byte) {
+		var inv invalidation
+		if err := json.Unmarshal(msg, &inv); err != nil || inv.Origin == rc.id {
+			return
+		}
+		rc.evictLocal(inv.Scope, inv.Value)
+	})
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrCacheMiss is returned by CacheStore.Get when a key is not stored
+var ErrCacheMiss = errors.New("cache miss")
+
+// CacheItem is a value written to a CacheStore
+type CacheItem struct {
+	Key     string
+	Value   []byte
+	TTL     time.Duration
+	Indexes []string // Index sets the key is added to
+}
+
+// CacheStore persists encoded cache entries together with the index sets
+// used to purge groups of entries by path or surrogate key
+type CacheStore interface {
+	// Get returns the values of keys in order, nil for keys not stored
+	Get(ctx context.Context, keys ...string) ([][]byte, error)
+
+	// Set stores every item and adds it to its indexes
+	Set(ctx context.Context, items ...CacheItem) error
+
+	// Delete removes keys and returns how many existed
+	Delete(ctx context.Context, keys ...string) (int64, error)
+
+	// PurgeIndex deletes the keys of an index accepted by match, or all of
+	// them when match is nil, and returns how many existed
+	PurgeIndex(ctx context.Context, index string, match func(key string) bool) (int64, error)
+
+	// PurgeIndexPrefix purges every index whose name starts with prefix
+	PurgeIndexPrefix(ctx context.Context, prefix string) (int64, error)
+
+	// Close releases resources held by the store
+	Close() error
+}
+
+// CacheBroadcaster is implemented by stores shared between gateway replicas
+// that can deliver invalidation messages to every replica
+type CacheBroadcaster interface {
+	Publish(ctx context.Context, msg []byte) error
+	Subscribe(ctx context.Context, handle func(msg []byte))
+}
+
+// getOne returns the value stored under key or ErrCacheMiss
+func getOne(ctx context.Context, store CacheStore, key string) ([]byte, error) {
+	vals, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if vals[0] == nil {
+		return nil, ErrCacheMiss
+	}
+	return vals[0], nil
+}
+
+// cacheIndex tracks index membership for stores without native sets.
+// It is not safe for concurrent use.
+type cacheIndex struct {
+	members map[string]map[string]struct{} // index -> keys
+	indexes map[string][]string            // key -> indexes
+}
+
+func newCacheIndex() *cacheIndex {
+	return &cacheIndex{
+		members: make(map[string]map[string]struct{}),
+		indexes: make(map[string][]string),
+	}
+}
+
+// add records key as a member of indexes
+func (ci *cacheIndex) add(key string, indexes []string) {
+	for _, index := range indexes {
+		set, ok := ci.members[index]
+		if !ok {
+			set = make(map[string]struct{})
+			ci.members[index] = set
+		}
+		if _, exists := set[key]; !exists {
+			set[key] = struct{}{}
+			ci.indexes[key] = append(ci.indexes[key], index)
+		}
+	}
+}
+
+// remove drops key from every index it belongs to
+func (ci *cacheIndex) remove(key string) {
+	for _, index := range ci.indexes[key] {
+		delete(ci.members[index], key)
+		if len(ci.members[index]) == 0 {
+			delete(ci.members, index)
+		}
+	}
+	delete(ci.indexes, key)
+}
+
+// keys returns the members of index accepted by match, or all when nil
+func (ci *cacheIndex) keys(index string, match func(key string) bool) []string {
+	var keys []string
+	for key := range ci.members[index] {
+		if match == nil || match(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// keysWithPrefix returns the members of every index starting with prefix
+func (ci *cacheIndex) keysWithPrefix(prefix string) []string {
+	var keys []string
+	for index := range ci.members {
+		if strings.HasPrefix(index, prefix) {
+			keys = append(keys, ci.keys(index, nil)...)
+		}
+	}
+	return keys
+}
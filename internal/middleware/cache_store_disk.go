@@ -0,0 +1,343 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskMagic prefixes every file written by DiskStore
+const diskMagic = "GWD1"
+
+// diskSweepInterval is how often expired files are removed during writes
+const diskSweepInterval = time.Minute
+
+// diskFile describes a stored file
+type diskFile struct {
+	path    string
+	expires time.Time
+}
+
+// DiskStore is a CacheStore keeping one file per key below a directory.
+// Keys and index membership are stored in each file's header so the store
+// survives restarts.
+type DiskStore struct {
+	dir       string
+	mu        sync.Mutex
+	files     map[string]diskFile
+	index     *cacheIndex
+	lastSweep time.Time
+}
+
+// NewDiskStore opens or creates a store below dir, loading the files
+// already present and removing expired or unreadable ones. It refuses a
+// directory holding anything but the store's own files, so a misconfigured
+// path never loses unrelated data.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	paths, err := diskStoreFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &DiskStore{
+		dir:       dir,
+		files:     make(map[string]diskFile),
+		index:     newCacheIndex(),
+		lastSweep: time.Now(),
+	}
+
+	now := time.Now()
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".tmp") {
+			os.Remove(path)
+			continue
+		}
+
+		key, indexes, expires, err := readDiskHeader(path)
+		if err != nil || !now.Before(expires) || path != s.pathFor(key) {
+			os.Remove(path)
+			continue
+		}
+		s.files[key] = diskFile{path: path, expires: expires}
+		s.index.add(key, indexes)
+	}
+
+	return s, nil
+}
+
+// diskStoreFiles returns the files of a store directory, laid out as
+// "<2 hex>/<64 hex>" entries and "<2 hex>/*.tmp" files left by interrupted
+// writes. Any other content is an error.
+func diskStoreFiles(dir string) ([]string, error) {
+	foreign := func(path string) error {
+		return fmt.Errorf("cache directory %s contains %s, which was not written by the cache; remove it or choose another cache.disk_path", dir, path)
+	}
+
+	subdirs, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache directory: %w", err)
+	}
+	var paths []string
+	for _, sub := range subdirs {
+		if !sub.IsDir() || !isHex(sub.Name(), 2) {
+			return nil, foreign(sub.Name())
+		}
+		entries, err := os.ReadDir(filepath.Join(dir, sub.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load cache directory: %w", err)
+		}
+		for _, entry := range entries {
+			name := filepath.Join(sub.Name(), entry.Name())
+			if !entry.Type().IsRegular() {
+				return nil, foreign(name)
+			}
+			entryFile := isHex(entry.Name(), sha256.Size*2) && strings.HasPrefix(entry.Name(), sub.Name())
+			if !entryFile && !strings.HasSuffix(entry.Name(), ".tmp") {
+				return nil, foreign(name)
+			}
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	return paths, nil
+}
+
+// isHex reports whether s is n lower case hexadecimal digits
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && (s[i] < 'a' || s[i] > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the values of keys in order, nil for keys not stored
+func (s *DiskStore) Get(ctx context.Context, keys ...string) ([][]byte, error) {
+	out := make([][]byte, len(keys))
+	now := time.Now()
+	for i, key := range keys {
+		s.mu.Lock()
+		file, ok := s.files[key]
+		if ok && !now.Before(file.expires) {
+			s.removeLocked(key)
+			ok = false
+		}
+		s.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		data, err := os.ReadFile(file.path)
+		if err != nil {
+			continue
+		}
+		if value, err := decodeDiskFile(data, key); err == nil {
+			out[i] = value
+		}
+	}
+	return out, nil
+}
+
+// Set stores every item and adds it to its indexes
+func (s *DiskStore) Set(ctx context.Context, items ...CacheItem) error {
+	for _, item := range items {
+		if err := s.set(item.Key, item.Value, item.TTL, item.Indexes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set writes a single file and records it
+func (s *DiskStore) set(key string, value []byte, ttl time.Duration, indexes []string) error {
+	expires := time.Now().Add(ttl)
+	path := s.pathFor(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(encodeDiskFile(key, indexes, expires, value)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	s.index.remove(key)
+	s.files[key] = diskFile{path: path, expires: expires}
+	s.index.add(key, indexes)
+
+	if time.Since(s.lastSweep) > diskSweepInterval {
+		s.sweepLocked()
+	}
+	return nil
+}
+
+// Delete removes keys and returns how many existed
+func (s *DiskStore) Delete(ctx context.Context, keys ...string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteLocked(keys), nil
+}
+
+// PurgeIndex deletes the keys of an index accepted by match, or all of them
+// when match is nil
+func (s *DiskStore) PurgeIndex(ctx context.Context, index string, match func(key string) bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteLocked(s.index.keys(index, match)), nil
+}
+
+// PurgeIndexPrefix purges every index whose name starts with prefix
+func (s *DiskStore) PurgeIndexPrefix(ctx context.Context, prefix string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteLocked(s.index.keysWithPrefix(prefix)), nil
+}
+
+// Close is a no-op; stored files are kept for the next start
+func (s *DiskStore) Close() error {
+	return nil
+}
+
+// pathFor returns the file holding key, fanned out over subdirectories
+func (s *DiskStore) pathFor(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(s.dir, name[:2], name)
+}
+
+func (s *DiskStore) deleteLocked(keys []string) int64 {
+	var deleted int64
+	now := time.Now()
+	for _, key := range keys {
+		if file, ok := s.files[key]; ok {
+			if now.Before(file.expires) {
+				deleted++
+			}
+			s.removeLocked(key)
+		}
+	}
+	return deleted
+}
+
+func (s *DiskStore) removeLocked(key string) {
+	if file, ok := s.files[key]; ok {
+		os.Remove(file.path)
+		delete(s.files, key)
+		s.index.remove(key)
+	}
+}
+
+// sweepLocked removes every expired file
+func (s *DiskStore) sweepLocked() {
+	now := time.Now()
+	for key, file := range s.files {
+		if !now.Before(file.expires) {
+			s.removeLocked(key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// encodeDiskFile lays out a file as magic, expiry, key, indexes and value
+func encodeDiskFile(key string, indexes []string, expires time.Time, value []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(diskMagic)
+	buf.Write(binary.BigEndian.AppendUint64(nil, uint64(expires.UnixNano())))
+	writeBytes(&buf, []byte(key))
+	buf.Write(binary.AppendUvarint(nil, uint64(len(indexes))))
+	for _, index := range indexes {
+		writeBytes(&buf, []byte(index))
+	}
+	buf.Write(value)
+	return buf.Bytes()
+}
+
+// decodeDiskFile returns the value of a file written for key
+func decodeDiskFile(data []byte, key string) ([]byte, error) {
+	r := bytes.NewReader(data)
+	storedKey, _, _, err := parseDiskHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if storedKey != key {
+		return nil, errors.New("cache file belongs to another key")
+	}
+	return data[len(data)-r.Len():], nil
+}
+
+// readDiskHeader reads the header of the file at path
+func readDiskHeader(path string) (string, []string, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	defer f.Close()
+
+	return parseDiskHeader(bufio.NewReader(f))
+}
+
+// parseDiskHeader parses the key, indexes and expiry of a file
+func parseDiskHeader(r byteReader) (string, []string, time.Time, error) {
+	magic, err := readN(r, len(diskMagic))
+	if err != nil || string(magic) != diskMagic {
+		return "", nil, time.Time{}, errors.New("invalid cache file")
+	}
+	rawExpires, err := readN(r, 8)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	key, err := readBytes(r)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	indexes := make([]string, 0, min(count, 64))
+	for i := uint64(0); i < count; i++ {
+		index, err := readBytes(r)
+		if err != nil {
+			return "", nil, time.Time{}, err
+		}
+		indexes = append(indexes, string(index))
+	}
+
+	expires := time.Unix(0, int64(binary.BigEndian.Uint64(rawExpires)))
+	return string(key), indexes, expires, nil
+}
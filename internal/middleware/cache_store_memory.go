@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryItem is a value held by a MemoryStore
+type memoryItem struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// MemoryStore is a CacheStore held in process memory, bounded by the total
+// size of stored values and evicting the least recently used entries
+type MemoryStore struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	ll       *list.List
+	items    map[string]*list.Element
+	index    *cacheIndex
+}
+
+// NewMemoryStore creates an in-memory store holding at most maxBytes of
+// values, or an unbounded one when maxBytes is not positive
+func NewMemoryStore(maxBytes int) *MemoryStore {
+	return &MemoryStore{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		index:    newCacheIndex(),
+	}
+}
+
+// Get returns the values of keys in order, nil for keys not stored
+func (s *MemoryStore) Get(ctx context.Context, keys ...string) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	out := make([][]byte, len(keys))
+	for i, key := range keys {
+		el, ok := s.items[key]
+		if !ok {
+			continue
+		}
+		item := el.Value.(*memoryItem)
+		if !now.Before(item.expires) {
+			s.removeElement(el)
+			continue
+		}
+		s.ll.MoveToFront(el)
+		out[i] = item.value
+	}
+	return out, nil
+}
+
+// Set stores every item and adds it to its indexes
+func (s *MemoryStore) Set(ctx context.Context, items ...CacheItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, item := range items {
+		if s.maxBytes > 0 && len(item.Value) > s.maxBytes {
+			continue
+		}
+		if el, ok := s.items[item.Key]; ok {
+			s.removeElement(el)
+		}
+		s.items[item.Key] = s.ll.PushFront(&memoryItem{
+			key:     item.Key,
+			value:   item.Value,
+			expires: now.Add(item.TTL),
+		})
+		s.size += len(item.Value)
+		s.index.add(item.Key, item.Indexes)
+	}
+
+	for s.maxBytes > 0 && s.size > s.maxBytes {
+		s.removeElement(s.ll.Back())
+	}
+	return nil
+}
+
+// Delete removes keys and returns how many existed
+func (s *MemoryStore) Delete(ctx context.Context, keys ...string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteLocked(keys), nil
+}
+
+// PurgeIndex deletes the keys of an index accepted by match, or all of them
+// when match is nil
+func (s *MemoryStore) PurgeIndex(ctx context.Context, index string, match func(key string) bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteLocked(s.index.keys(index, match)), nil
+}
+
+// PurgeIndexPrefix purges every index whose name starts with prefix
+func (s *MemoryStore) PurgeIndexPrefix(ctx context.Context, prefix string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteLocked(s.index.keysWithPrefix(prefix)), nil
+}
+
+// Close releases the stored values
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ll.Init()
+	s.items = make(map[string]*list.Element)
+	s.index = newCacheIndex()
+	s.size = 0
+	return nil
+}
+
+func (s *MemoryStore) deleteLocked(keys []string) int64 {
+	var deleted int64
+	now := time.Now()
+	for _, key := range keys {
+		if el, ok := s.items[key]; ok {
+			if now.Before(el.Value.(*memoryItem).expires) {
+				deleted++
+			}
+			s.removeElement(el)
+		}
+	}
+	return deleted
+}
+
+func (s *MemoryStore) removeElement(el *list.Element) {
+	item := s.ll.Remove(el).(*memoryItem)
+	delete(s.items, item.key)
+	s.index.remove(item.key)
+	s.size -= len(item.value)
+}
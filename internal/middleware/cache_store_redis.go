@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// purgeBatchSize bounds the number of keys scanned or deleted per command
+const purgeBatchSize = 500
+
+// cacheInvalidationChannel is the Redis pub/sub channel replicas use to
+// evict entries from each other's in-process cache
+const cacheInvalidationChannel = "cache:invalidate"
+
+// RedisStore is a CacheStore backed by Redis. Index sets are kept as Redis
+// sets that live as long as their longest-lived member.
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisStore creates a store using the given Redis client
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{
+		client: client,
+	}
+}
+
+// Get returns the values of keys in order, nil for keys not stored
+func (s *RedisStore) Get(ctx context.Context, keys ...string) ([][]byte, error) {
+	// A pipeline rather than MGET keeps keys in different cluster slots working
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	out := make([][]byte, len(keys))
+	for i, cmd := range cmds {
+		if val, err := cmd.Bytes(); err == nil {
+			out[i] = val
+		}
+	}
+	return out, nil
+}
+
+// Set stores every item and adds it to its indexes
+func (s *RedisStore) Set(ctx context.Context, items ...CacheItem) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, item := range items {
+			pipe.Set(ctx, item.Key, item.Value, item.TTL)
+			for _, index := range item.Indexes {
+				// Extend but never shorten the index expiration
+				pipe.SAdd(ctx, index, item.Key)
+				pipe.ExpireNX(ctx, index, item.TTL)
+				pipe.ExpireGT(ctx, index, item.TTL)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// Delete removes keys and returns how many existed
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) (int64, error) {
+	var deleted int64
+	for start := 0; start < len(keys); start += purgeBatchSize {
+		batch := keys[start:min(start+purgeBatchSize, len(keys))]
+		n, err := s.del(ctx, batch, "")
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// del deletes keys, removing them from index unless it is empty, and returns
+// how many existed. Keys are deleted one per command in a pipeline, as a
+// cluster rejects commands with keys in different slots.
+func (s *RedisStore) del(ctx context.Context, keys []string, index string) (int64, error) {
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Del(ctx, key)
+		}
+		if index != "" {
+			members := make([]interface{}, len(keys))
+			for i, key := range keys {
+				members[i] = key
+			}
+			pipe.SRem(ctx, index, members...)
+		}
+		return nil
+	})
+
+	var deleted int64
+	for _, cmd := range cmds {
+		deleted += cmd.Val()
+	}
+	return deleted, err
+}
+
+// PurgeIndex deletes the keys of an index accepted by match, or all of them
+// when match is nil
+func (s *RedisStore) PurgeIndex(ctx context.Context, index string, match func(key string) bool) (int64, error) {
+	keys, err := s.client.SMembers(ctx, index).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	var doomed []string
+	for _, key := range keys {
+		if match == nil || match(key) {
+			doomed = append(doomed, key)
+		}
+	}
+
+	var purged int64
+	for start := 0; start < len(doomed); start += purgeBatchSize {
+		batch := doomed[start:min(start+purgeBatchSize, len(doomed))]
+		n, err := s.del(ctx, batch, index)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// PurgeIndexPrefix purges every index whose name starts with prefix
+func (s *RedisStore) PurgeIndexPrefix(ctx context.Context, prefix string) (int64, error) {
+	indexes, err := s.scan(ctx, escapeGlob(prefix)+"*")
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for _, index := range indexes {
+		n, err := s.PurgeIndex(ctx, index, nil)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// scan returns the keys matching pattern. A cluster spreads keys over its
+// masters, so each of them is scanned.
+func (s *RedisStore) scan(ctx context.Context, pattern string) ([]string, error) {
+	cluster := clusterClient(s.client)
+	if cluster == nil {
+		return scanKeys(ctx, s.client, pattern)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		found, err := scanKeys(ctx, node, pattern)
+		mu.Lock()
+		keys = append(keys, found...)
+		mu.Unlock()
+		return err
+	})
+	return keys, err
+}
+
+// clusterClient returns the cluster client behind client, looking through
+// wrappers with an Unwrap method, or nil if it is not a cluster client
+func clusterClient(client redis.UniversalClient) *redis.ClusterClient {
+	switch c := client.(type) {
+	case *redis.ClusterClient:
+		return c
+	case interface{ Unwrap() redis.UniversalClient }:
+		return clusterClient(c.Unwrap())
+	}
+	return nil
+}
+
+// scanKeys returns the keys of a single server matching pattern
+func scanKeys(ctx context.Context, client redis.Cmdable, pattern string) ([]string, error) {
+	var keys []string
+	iter := client.Scan(ctx, 0, pattern, purgeBatchSize).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// Publish sends an invalidation message to every replica
+func (s *RedisStore) Publish(ctx context.Context, msg []byte) error {
+	return s.client.Publish(ctx, cacheInvalidationChannel, msg).Err()
+}
+
+// Subscribe delivers invalidation messages to handle until ctx is cancelled
+func (s *RedisStore) Subscribe(ctx context.Context, handle func(msg []byte)) {
+	pubsub := s.client.Subscribe(ctx, cacheInvalidationChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			handle([]byte(msg.Payload))
+		}
+	}
+}
+
+// Close releases the Redis client
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// escapeGlob escapes Redis glob metacharacters in s
+func escapeGlob(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b = append(b, '\\')
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
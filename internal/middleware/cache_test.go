@@ -0,0 +1,680 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/config"
+	"api-gateway/internal/logging"
+	"api-gateway/internal/middleware"
+	"api-gateway/internal/redisclient"
+	utilhttp "api-gateway/internal/utils/http"
+)
+
+func testCacheConfig() *config.CacheConfig {
+	return &config.CacheConfig{
+		Duration:            60,
+		StaleTTL:            300,
+		StaleIfError:        300,
+		MaxBodyBytes:        1 << 20,
+		CompressionMinBytes: 64,
+	}
+}
+
+// newCachedRouter serves GET and PUT /items/:id through a response cache
+// backed by store, counting origin calls
+func newCachedRouter(cfg *config.CacheConfig, store middleware.CacheStore, body []byte, calls *atomic.Int32) (*gin.Engine, *middleware.ResponseCache) {
+	gin.SetMode(gin.TestMode)
+	rc := middleware.NewResponseCache(cfg, store)
+
+	r := gin.New()
+	r.Use(rc.Middleware())
+	r.GET("/items/:id", func(c *gin.Context) {
+		calls.Add(1)
+		c.Header("Surrogate-Key", "items item-"+c.Param("id"))
+		c.Data(http.StatusOK, "application/octet-stream", body)
+	})
+	r.PUT("/items/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return r, rc
+}
+
+func serve(r http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestResponseCache_HitAndBinaryBody(t *testing.T) {
+	// Invalid UTF-8 and a compressible run must survive the round trip
+	body := append([]byte{0xff, 0xfe, 0x00, 0x80}, []byte(strings.Repeat("a", 4096))...)
+	var calls atomic.Int32
+	r, _ := newCachedRouter(testCacheConfig(), middleware.NewMemoryStore(0), body, &calls)
+
+	first := serve(r, http.MethodGet, "/items/1", nil)
+	assert.Equal(t, "MISS", first.Header().Get("X-Cache"))
+	assert.Equal(t, body, first.Body.Bytes())
+
+	second := serve(r, http.MethodGet, "/items/1", nil)
+	assert.Equal(t, "HIT", second.Header().Get("X-Cache"))
+	assert.Equal(t, body, second.Body.Bytes())
+	assert.Equal(t, first.Header().Get("ETag"), second.Header().Get("ETag"))
+	assert.Equal(t, int32(1), calls.Load())
+
+	notModified := serve(r, http.MethodGet, "/items/1", http.Header{"If-None-Match": {first.Header().Get("ETag")}})
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.Bytes())
+}
+
+func TestResponseCache_MaxBodyBytes(t *testing.T) {
+	cfg := testCacheConfig()
+	cfg.MaxBodyBytes = 16
+	body := []byte(strings.Repeat("x", 64))
+	var calls atomic.Int32
+	r, _ := newCachedRouter(cfg, middleware.NewMemoryStore(0), body, &calls)
+
+	for i := 0; i < 2; i++ {
+		w := serve(r, http.MethodGet, "/items/1", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, body, w.Body.Bytes())
+		assert.Empty(t, w.Header().Get("X-Cache"), "oversized bodies are streamed uncached")
+	}
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestResponseCache_Invalidation(t *testing.T) {
+	var calls atomic.Int32
+	r, rc := newCachedRouter(testCacheConfig(), middleware.NewMemoryStore(0), []byte("item"), &calls)
+
+	serve(r, http.MethodGet, "/items/1", nil)
+	serve(r, http.MethodGet, "/items/2", nil)
+	assert.Equal(t, "HIT", serve(r, http.MethodGet, "/items/1", nil).Header().Get("X-Cache"))
+
+	serve(r, http.MethodPut, "/items/1", nil)
+	assert.Equal(t, "MISS", serve(r, http.MethodGet, "/items/1", nil).Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", serve(r, http.MethodGet, "/items/2", nil).Header().Get("X-Cache"))
+
+	purged, err := rc.PurgeTag(context.Background(), "items")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+	assert.Equal(t, "MISS", serve(r, http.MethodGet, "/items/2", nil).Header().Get("X-Cache"))
+}
+
+func TestResponseCache_NoStore(t *testing.T) {
+	var calls atomic.Int32
+	r, rc := newCachedRouter(testCacheConfig(), nil, []byte("item"), &calls)
+
+	w := serve(r, http.MethodGet, "/items/1", nil)
+	assert.Equal(t, "BYPASS", w.Header().Get("X-Cache"))
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+
+	_, err := rc.PurgeTag(context.Background(), "items")
+	assert.ErrorIs(t, err, middleware.ErrCacheDisabled)
+}
+
+func TestResponseCache_UpstreamRevalidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// The upstream answers If-None-Match for its current version with 304
+	var version atomic.Int32
+	var calls, notModified atomic.Int32
+	version.Store(1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, `{"version":%d}`, version.Load())
+	}))
+	defer upstream.Close()
+	sender := utilhttp.NewHTTPSender(upstream.URL, 0)
+
+	cfg := testCacheConfig()
+	cfg.StaleWhileRevalidate = 0
+	rc := middleware.NewResponseCache(cfg, middleware.NewMemoryStore(0))
+	r := gin.New()
+	r.Use(rc.Middleware())
+	r.GET("/items", func(c *gin.Context) {
+		var body map[string]any
+		if err := sender.Get(c.Request.Context(), "/", &body); err != nil {
+			if errors.Is(err, utilhttp.ErrNotModified) {
+				c.Status(http.StatusNotModified)
+				return
+			}
+			c.Status(http.StatusBadGateway)
+			return
+		}
+		c.Header("Cache-Control", "max-age=0")
+		c.JSON(http.StatusOK, body)
+	})
+
+	w := serve(r, http.MethodGet, "/items", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, `{"version":1}`, w.Body.String())
+
+	// The stale entry is revalidated with the upstream's ETag
+	w = serve(r, http.MethodGet, "/items", nil)
+	assert.Equal(t, "REVALIDATED", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, `{"version":1}`, w.Body.String())
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, int32(1), notModified.Load())
+
+	// A changed upstream response replaces the entry
+	version.Store(2)
+	w = serve(r, http.MethodGet, "/items", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, `{"version":2}`, w.Body.String())
+	w = serve(r, http.MethodGet, "/items", nil)
+	assert.Equal(t, "REVALIDATED", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, `{"version":2}`, w.Body.String())
+	assert.Equal(t, int32(2), notModified.Load())
+}
+
+func TestDiskStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := middleware.NewDiskStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx,
+		middleware.CacheItem{Key: "a", Value: []byte{0x00, 0xff}, TTL: time.Minute, Indexes: []string{"tag:x"}},
+		middleware.CacheItem{Key: "b", Value: []byte("b"), TTL: time.Minute, Indexes: []string{"tag:x", "tag:y"}},
+		middleware.CacheItem{Key: "c", Value: []byte("c"), TTL: -time.Second},
+	))
+
+	// Entries and indexes survive reopening the directory
+	store, err = middleware.NewDiskStore(dir)
+	require.NoError(t, err)
+	vals, err := store.Get(ctx, "a", "b", "c", "d")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{{0x00, 0xff}, []byte("b"), nil, nil}, vals)
+
+	purged, err := store.PurgeIndex(ctx, "tag:y", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	purged, err = store.PurgeIndexPrefix(ctx, "tag:")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	vals, err = store.Get(ctx, "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{nil, nil}, vals)
+}
+
+func TestDiskStore_ForeignFiles(t *testing.T) {
+	ctx := context.Background()
+	for _, foreign := range []string{"important.txt", "sub/notes.md", "ab/notes.md", "ab/cd/" + strings.Repeat("a", 64)} {
+		t.Run(foreign, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := middleware.NewDiskStore(dir)
+			require.NoError(t, err)
+			require.NoError(t, store.Set(ctx, middleware.CacheItem{Key: "a", Value: []byte("a"), TTL: time.Minute}))
+
+			path := filepath.Join(dir, filepath.FromSlash(foreign))
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+			require.NoError(t, os.WriteFile(path, []byte("keep me"), 0o600))
+
+			// The directory is refused and nothing in it is removed
+			_, err = middleware.NewDiskStore(dir)
+			assert.ErrorContains(t, err, "was not written by the cache")
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, "keep me", string(data))
+			vals, err := store.Get(ctx, "a")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("a"), vals[0])
+		})
+	}
+
+	// Leftover temporary and unreadable entry files are the store's own
+	dir := t.TempDir()
+	leftovers := []string{"ab/123.tmp", "ab/ab" + strings.Repeat("b", 62)}
+	for _, leftover := range leftovers {
+		path := filepath.Join(dir, filepath.FromSlash(leftover))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+		require.NoError(t, os.WriteFile(path, []byte("partial"), 0o600))
+	}
+	_, err := middleware.NewDiskStore(dir)
+	require.NoError(t, err)
+	for _, leftover := range leftovers {
+		assert.NoFileExists(t, filepath.Join(dir, filepath.FromSlash(leftover)))
+	}
+}
+
+func TestRedisStore_PurgeIndexPrefix(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	gateway, err := redisclient.New(&config.RedisConfig{Addrs: []string{mr.Addr(), mr.Addr()}}, logging.Discard())
+	require.NoError(t, err)
+	require.IsType(t, &redis.ClusterClient{}, gateway.Unwrap())
+
+	for name, client := range map[string]redis.UniversalClient{
+		"standalone": redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		"cluster":    redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}}),
+		"gateway":    gateway,
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer client.Close()
+			store := middleware.NewRedisStore(client)
+			require.NoError(t, store.Set(ctx,
+				middleware.CacheItem{Key: name + ":a", Value: []byte("a"), TTL: time.Minute, Indexes: []string{name + ":path:/items/1"}},
+				middleware.CacheItem{Key: name + ":b", Value: []byte("b"), TTL: time.Minute, Indexes: []string{name + ":path:/items/2"}},
+				middleware.CacheItem{Key: name + ":c", Value: []byte("c"), TTL: time.Minute, Indexes: []string{name + ":path:/users/1"}},
+			))
+
+			purged, err := store.PurgeIndexPrefix(ctx, name+":path:/items")
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), purged)
+			vals, err := store.Get(ctx, name+":a", name+":b", name+":c")
+			require.NoError(t, err)
+			assert.Equal(t, [][]byte{nil, nil, []byte("c")}, vals)
+		})
+	}
+}
+
+// crossSlotHook fails multi-key DEL commands whose keys hash to different
+// cluster slots, as a Redis cluster does
+type crossSlotHook struct{}
+
+func (crossSlotHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (crossSlotHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := checkSlots(cmd); err != nil {
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (crossSlotHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if err := checkSlots(cmd); err != nil {
+				return err
+			}
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func checkSlots(cmd redis.Cmder) error {
+	if cmd.Name() != "del" {
+		return nil
+	}
+	args := cmd.Args()
+	for _, key := range args[2:] {
+		if keySlot(key.(string)) != keySlot(args[1].(string)) {
+			err := errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+			cmd.SetErr(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// keySlot returns the cluster slot of key, the CRC16 of its hash tag or of
+// the whole key modulo 16384
+func keySlot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc % 16384
+}
+
+func TestRedisStore_ClusterSlots(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+	defer client.Close()
+	client.AddHook(crossSlotHook{})
+
+	keys := []string{"entry:a", "entry:b", "entry:c", "entry:d"}
+	require.NotEqual(t, keySlot(keys[0]), keySlot(keys[1]))
+	store := middleware.NewRedisStore(client)
+	set := func() {
+		var items []middleware.CacheItem
+		for _, key := range keys {
+			items = append(items, middleware.CacheItem{Key: key, Value: []byte(key), TTL: time.Minute, Indexes: []string{"tag:all"}})
+		}
+		require.NoError(t, store.Set(ctx, items...))
+	}
+
+	set()
+	deleted, err := store.Delete(ctx, keys...)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), deleted)
+
+	set()
+	purged, err := store.PurgeIndex(ctx, "tag:all", func(key string) bool { return key != "entry:d" })
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+	vals, err := store.Get(ctx, keys...)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{nil, nil, nil, []byte("entry:d")}, vals)
+	members, err := client.SMembers(ctx, "tag:all").Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"entry:d"}, members)
+}
+
+func TestResponseCache_KeyRules(t *testing.T) {
+	cfg := testCacheConfig()
+	cfg.Namespace = "gw"
+	cfg.KeyVersion = "v2"
+	cfg.IgnoreQuery = []string{"utm_*"}
+	cfg.Routes = []config.CacheRouteConfig{
+		{Route: "/items/:id", QueryInclude: []string{"a", "b", "utm_source"}, Headers: []string{"x-tenant"}},
+		{Route: "/items", Disabled: true},
+	}
+	var calls atomic.Int32
+	r, rc := newCachedRouter(cfg, middleware.NewMemoryStore(0), []byte("item"), &calls)
+	r.GET("/items", func(c *gin.Context) { c.String(http.StatusOK, "list") })
+
+	tenant := func(name string) http.Header { return http.Header{"X-Tenant": {name}} }
+
+	assert.Equal(t, "MISS", serve(r, http.MethodGet, "/items/1?a=1&b=2", tenant("acme")).Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", serve(r, http.MethodGet, "/items/1?b=2&a=1&utm_source=mail&c=3", tenant("acme")).Header().Get("X-Cache"),
+		"query order, tracking and unlisted parameters do not change the key")
+	assert.Equal(t, "MISS", serve(r, http.MethodGet, "/items/1?a=1&b=2", tenant("other")).Header().Get("X-Cache"),
+		"configured headers are part of the key")
+	assert.Equal(t, "BYPASS", serve(r, http.MethodGet, "/items", nil).Header().Get("X-Cache"))
+
+	purged, err := rc.PurgeKey(context.Background(), "/items/1?b=2&a=1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), purged, "both tenants' entries and vary records")
+	assert.Equal(t, "MISS", serve(r, http.MethodGet, "/items/1?a=1&b=2", tenant("acme")).Header().Get("X-Cache"))
+}
+
+func TestResponseCache_PrincipalKeyRules(t *testing.T) {
+	middleware.SetJWTSecret("test-secret")
+	bearer := func(claims jwt.MapClaims) http.Header {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+		require.NoError(t, err)
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+
+	cfg := testCacheConfig()
+	cfg.Routes = []config.CacheRouteConfig{{Route: "/items/:id", Principal: []string{"tenant"}}}
+	var calls atomic.Int32
+	r, _ := newCachedRouter(cfg, middleware.NewMemoryStore(0), []byte("item"), &calls)
+
+	acme, other := bearer(jwt.MapClaims{"tenant": "acme", "user_id": 1}), bearer(jwt.MapClaims{"tenant": "other"})
+	assert.Equal(t, "MISS", serve(r, http.MethodGet, "/items/1", acme).Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", serve(r, http.MethodGet, "/items/1", bearer(jwt.MapClaims{"tenant": "acme", "user_id": 2})).Header().Get("X-Cache"),
+		"authenticated responses are stored for the principal")
+	assert.Equal(t, "MISS", serve(r, http.MethodGet, "/items/1", other).Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", serve(r, http.MethodGet, "/items/1", other).Header().Get("X-Cache"))
+
+	// Tokens without the claims, or not signed with the secret, are not
+	// stored under a principal
+	for name, header := range map[string]http.Header{
+		"missing claim": bearer(jwt.MapClaims{"user_id": 1}),
+		"invalid token": {"Authorization": {"Bearer " + strings.Repeat("x", 20)}},
+	} {
+		serve(r, http.MethodGet, "/items/2", header)
+		assert.Equal(t, "MISS", serve(r, http.MethodGet, "/items/2", header).Header().Get("X-Cache"), name)
+	}
+	assert.Equal(t, int32(6), calls.Load())
+}
+
+func TestResponseCache_Coalescing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var calls, waiting atomic.Int32
+	release := make(chan struct{})
+	rc := middleware.NewResponseCache(testCacheConfig(), middleware.NewMemoryStore(0))
+	r := gin.New()
+	r.Use(rc.Middleware())
+	r.GET("/items", func(c *gin.Context) {
+		calls.Add(1)
+		<-release
+		c.String(http.StatusOK, "items")
+	})
+
+	const clients = 8
+	results := make(chan *httptest.ResponseRecorder, clients)
+	for i := 0; i < clients; i++ {
+		go func() {
+			waiting.Add(1)
+			results <- serve(r, http.MethodGet, "/items", nil)
+		}()
+	}
+	require.Eventually(t, func() bool { return waiting.Load() == clients && calls.Load() == 1 }, time.Second, time.Millisecond)
+	// Give the followers time to join the origin request
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < clients; i++ {
+		w := <-results
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "items", w.Body.String())
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestResponseCache_StaleWhileRevalidate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var calls atomic.Int32
+	rc := middleware.NewResponseCache(testCacheConfig(), middleware.NewMemoryStore(0))
+	r := gin.New()
+	r.Use(rc.Middleware())
+	r.GET("/items", func(c *gin.Context) {
+		n := calls.Add(1)
+		c.Header("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		c.String(http.StatusOK, "version %d", n)
+	})
+	rc.SetRefreshHandler(r)
+
+	serve(r, http.MethodGet, "/items", nil)
+	w := serve(r, http.MethodGet, "/items", nil)
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	assert.Equal(t, "version 1", w.Body.String())
+
+	// Close waits for the background refresh
+	require.NoError(t, rc.Close())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestResponseCache_StaleIfError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var calls atomic.Int32
+	cfg := testCacheConfig()
+	cfg.StaleWhileRevalidate = 0
+	rc := middleware.NewResponseCache(cfg, middleware.NewMemoryStore(0))
+	r := gin.New()
+	r.Use(rc.Middleware())
+	r.GET("/items", func(c *gin.Context) {
+		if calls.Add(1) > 1 {
+			c.String(http.StatusBadGateway, "upstream down")
+			return
+		}
+		c.Header("Cache-Control", "max-age=0")
+		c.String(http.StatusOK, "items")
+	})
+
+	serve(r, http.MethodGet, "/items", nil)
+	w := serve(r, http.MethodGet, "/items", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	assert.Equal(t, "items", w.Body.String())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+// broadcastStore is a memory store shared by several caches that delivers
+// invalidation messages synchronously, calling onPublish after each
+type broadcastStore struct {
+	*middleware.MemoryStore
+
+	mu          sync.Mutex
+	subscribers []func(msg []byte)
+	onPublish   func()
+}
+
+func (s *broadcastStore) Publish(ctx context.Context, msg []byte) error {
+	s.mu.Lock()
+	subscribers, onPublish := s.subscribers, s.onPublish
+	s.mu.Unlock()
+	for _, handle := range subscribers {
+		handle(msg)
+	}
+	if onPublish != nil {
+		onPublish()
+	}
+	return nil
+}
+
+func (s *broadcastStore) Subscribe(ctx context.Context, handle func(msg []byte)) {
+	s.mu.Lock()
+	s.subscribers = append(s.subscribers, handle)
+	s.mu.Unlock()
+	<-ctx.Done()
+}
+
+func (s *broadcastStore) subscribed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers)
+}
+
+func TestResponseCache_L1VaryInvalidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := testCacheConfig()
+	cfg.L1MaxBytes = 1 << 20
+	cfg.L1TTL = 60
+	store := &broadcastStore{MemoryStore: middleware.NewMemoryStore(0)}
+
+	// Two replicas sharing the store, the response stops varying after the
+	// first one
+	var version atomic.Int32
+	newReplica := func() (*gin.Engine, *middleware.ResponseCache) {
+		rc := middleware.NewResponseCache(cfg, store)
+		r := gin.New()
+		r.Use(rc.Middleware())
+		r.GET("/items", func(c *gin.Context) {
+			v := version.Add(1)
+			if v == 1 {
+				c.Header("Vary", "Accept-Language")
+			}
+			c.String(http.StatusOK, "version %d", v)
+		})
+		return r, rc
+	}
+	a, _ := newReplica()
+	b, rcB := newReplica()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rcB.Listen(ctx)
+	require.Eventually(t, func() bool { return store.subscribed() == 1 }, time.Second, time.Millisecond)
+
+	english := http.Header{"Accept-Language": {"en"}}
+	assert.Equal(t, "version 1", serve(b, http.MethodGet, "/items", english).Body.String())
+
+	// Another language misses on the first replica, which stores a response
+	// without Vary for every language
+	assert.Equal(t, "version 2", serve(a, http.MethodGet, "/items", http.Header{"Accept-Language": {"fr"}}).Body.String())
+
+	// The other replica drops its vary record rather than serving the
+	// variant it lists
+	assert.Equal(t, "version 2", serve(b, http.MethodGet, "/items", english).Body.String())
+}
+
+func TestResponseCache_L1Invalidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range []struct {
+		name  string
+		purge func(rc *middleware.ResponseCache) (int64, error)
+	}{
+		{"key", func(rc *middleware.ResponseCache) (int64, error) {
+			return rc.PurgeKey(context.Background(), "/items/1")
+		}},
+		{"prefix", func(rc *middleware.ResponseCache) (int64, error) {
+			return rc.PurgePrefix(context.Background(), "/items")
+		}},
+		{"tag", func(rc *middleware.ResponseCache) (int64, error) { return rc.PurgeTag(context.Background(), "items") }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testCacheConfig()
+			cfg.L1MaxBytes = 1 << 20
+			cfg.L1TTL = 60
+			store := &broadcastStore{MemoryStore: middleware.NewMemoryStore(0)}
+
+			// Two replicas sharing the store, each with an in-process cache
+			var version atomic.Int32
+			newReplica := func() (*gin.Engine, *middleware.ResponseCache) {
+				rc := middleware.NewResponseCache(cfg, store)
+				r := gin.New()
+				r.Use(rc.Middleware())
+				r.GET("/items/:id", func(c *gin.Context) {
+					c.Header("Surrogate-Key", "items")
+					c.String(http.StatusOK, "version %d", version.Add(1))
+				})
+				return r, rc
+			}
+			a, rcA := newReplica()
+			b, rcB := newReplica()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go rcB.Listen(ctx)
+			require.Eventually(t, func() bool { return store.subscribed() == 1 }, time.Second, time.Millisecond)
+
+			assert.Equal(t, "version 1", serve(a, http.MethodGet, "/items/1", nil).Body.String())
+			assert.Equal(t, "version 1", serve(b, http.MethodGet, "/items/1", nil).Body.String())
+
+			// A request reaching the other replica as soon as it evicted its
+			// in-process cache must not find the purged entry in the store
+			store.onPublish = func() {
+				assert.Equal(t, "version 2", serve(b, http.MethodGet, "/items/1", nil).Body.String())
+			}
+			purged, err := tt.purge(rcA)
+			require.NoError(t, err)
+			assert.Positive(t, purged)
+			store.onPublish = nil
+
+			assert.Equal(t, "version 2", serve(b, http.MethodGet, "/items/1", nil).Body.String())
+			assert.Equal(t, "version 2", serve(a, http.MethodGet, "/items/1", nil).Body.String())
+		})
+	}
+}
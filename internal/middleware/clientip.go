@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"api-gateway/internal/clientip"
+)
+
+// ClientIP is a middleware resolving the client of requests that arrive
+// through trusted proxies. The forwarding is stored in the request context,
+// where upstream requests pick it up, and the remote address of the request
+// is replaced by the client's so c.ClientIP() returns it. The engine itself
+// must trust no proxies.
+func ClientIP(resolver *clientip.Resolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		f := resolver.Resolve(c.Request)
+		c.Request.RemoteAddr = clientip.RemoteAddr(c.Request, f)
+		c.Request = c.Request.WithContext(clientip.WithContext(c.Request.Context(), f))
+		c.Next()
+	}
+}
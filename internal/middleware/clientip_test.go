@@ -0,0 +1,55 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/internal/clientip"
+	"api-gateway/internal/middleware"
+	utilhttp "api-gateway/internal/utils/http"
+)
+
+func TestClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Upstream records the forwarding headers it receives
+	var upstreamHeader http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeader = r.Header.Clone()
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+	sender := utilhttp.NewHTTPSender(upstream.URL, 0)
+
+	// Requests built by httptest come from 192.0.2.1
+	resolver, err := clientip.NewResolver([]string{"192.0.2.0/24"})
+	require.NoError(t, err)
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies(nil))
+	r.Use(middleware.ClientIP(resolver))
+	r.GET("/proxy", func(c *gin.Context) {
+		require.NoError(t, sender.Get(c.Request.Context(), "/", nil))
+		c.String(http.StatusOK, c.ClientIP())
+	})
+
+	w := serve(r, http.MethodGet, "/proxy", http.Header{
+		"X-Forwarded-For":   {"198.51.100.1, 203.0.113.7"},
+		"X-Forwarded-Proto": {"https"},
+	})
+	assert.Equal(t, "203.0.113.7", w.Body.String())
+	assert.Equal(t, "203.0.113.7, 192.0.2.1", upstreamHeader.Get("X-Forwarded-For"), "hops before the client are dropped")
+	assert.Equal(t, "for=203.0.113.7;proto=https;host=example.com, for=192.0.2.1", upstreamHeader.Get("Forwarded"))
+	assert.Equal(t, "https", upstreamHeader.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "example.com", upstreamHeader.Get("X-Forwarded-Host"))
+
+	// Without forwarding headers the peer is the client
+	w = serve(r, http.MethodGet, "/proxy", nil)
+	assert.Equal(t, "192.0.2.1", w.Body.String())
+	assert.Equal(t, "192.0.2.1", upstreamHeader.Get("X-Forwarded-For"))
+	assert.Equal(t, "http", upstreamHeader.Get("X-Forwarded-Proto"))
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"api-gateway/config"
+)
+
+// HSTS returns a middleware setting the Strict-Transport-Security header on
+// responses to requests received over TLS. Browsers then refuse plain HTTP
+// for the host until max-age passes.
+func HSTS(cfg *config.HSTSConfig) gin.HandlerFunc {
+	value := "max-age=" + strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	if cfg.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if cfg.Preload {
+		value += "; preload"
+	}
+	return func(c *gin.Context) {
+		if c.Request.TLS != nil {
+			c.Header("Strict-Transport-Security", value)
+		}
+		c.Next()
+	}
+}
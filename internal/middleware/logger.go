@@ -2,34 +2,70 @@ package middleware
 
 import (
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
+	"api-gateway/internal/logging"
+	"api-gateway/internal/requestid"
 )
 
-// Logger is a middleware that logs the request details
-func Logger() gin.HandlerFunc {
+// Logger is a middleware that stores a request-scoped logger in the request
+// context and writes the request to the access log, if any, once it is
+// processed.
+func Logger(logger *slog.Logger, access *logging.AccessLogger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Start timer
 		start := time.Now()
 
+		ctx := c.Request.Context()
+		attrs := []any{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+		}
+		requestID := requestid.FromContext(ctx)
+		if requestID != "" {
+			attrs = append(attrs, slog.String("request_id", requestID))
+		}
+		var traceID string
+		if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+			traceID = sc.TraceID().String()
+			attrs = append(attrs, slog.String("trace_id", traceID))
+		}
+		ctx, upstreams := logging.WithUpstreams(logging.WithContext(ctx, logger.With(attrs...)))
+		c.Request = c.Request.WithContext(ctx)
+
 		// Process request
 		c.Next()
 
-		// Log details after request is processed
-		latency := time.Since(start)
-		statusCode := c.Writer.Status()
-		clientIP := c.ClientIP()
-		method := c.Request.Method
-		path := c.Request.URL.Path
-
-		fmt.Printf("[GIN] %v | %3d | %13v | %15s | %-7s %s\n",
-			time.Now().Format("2006/01/02 - 15:04:05"),
-			statusCode,
-			latency,
-			clientIP,
-			method,
-			path,
-		)
+		if access == nil {
+			return
+		}
+		entry := &logging.AccessEntry{
+			Time:      start,
+			Latency:   time.Since(start),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Query:     c.Request.URL.RawQuery,
+			Proto:     c.Request.Proto,
+			Route:     c.FullPath(),
+			Status:    c.Writer.Status(),
+			BytesIn:   max(c.Request.ContentLength, 0),
+			BytesOut:  int64(max(c.Writer.Size(), 0)),
+			ClientIP:  c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Referer:   c.Request.Referer(),
+			Upstream:  upstreams(),
+			Cache:     c.Writer.Header().Get("X-Cache"),
+			RequestID: requestID,
+			TraceID:   traceID,
+		}
+		// Set by JWTAuth on protected routes
+		if userID, ok := c.Get("user_id"); ok && userID != nil {
+			entry.User = fmt.Sprint(userID)
+		}
+		access.Log(entry)
 	}
 }
@@ -0,0 +1,110 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/config"
+	"api-gateway/internal/logging"
+	"api-gateway/internal/middleware"
+	utilhttp "api-gateway/internal/utils/http"
+)
+
+// newLoggedRouter serves /items/:id, calling an upstream, /health and
+// /fail through the logger middleware
+func newLoggedRouter(t *testing.T, logger *slog.Logger, cfg *config.LogConfig) *gin.Engine {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(upstream.Close)
+	sender := utilhttp.NewHTTPSender(upstream.URL, 0)
+	sender.SetObserver("user_service", nil)
+
+	access, err := logging.NewAccessLogger(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { access.Close() })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.RequestID(""))
+	r.Use(middleware.Logger(logger, access))
+	r.GET("/items/:id", func(c *gin.Context) {
+		logging.FromContext(c.Request.Context()).Info("handler")
+		require.NoError(t, sender.Get(c.Request.Context(), "/", nil))
+		c.Header("X-Cache", "MISS")
+		c.String(http.StatusOK, "item")
+	})
+	r.GET("/health", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/fail", func(c *gin.Context) {
+		c.Status(http.StatusBadRequest)
+	})
+	return r
+}
+
+func readLines(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestLogger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	path := filepath.Join(t.TempDir(), "access.log")
+	r := newLoggedRouter(t, slog.New(slog.NewJSONHandler(&buf, nil)), &config.LogConfig{
+		SuccessSampleRate: 1,
+		Access:            config.AccessLogConfig{Output: path, Skip: []string{"/health"}},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/items/1?q=1", strings.NewReader("body"))
+	req.Header.Set("X-Request-ID", "abc")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	serve(r, http.MethodGet, "/health", nil)
+
+	// The handler logs through the request-scoped logger
+	var handlerLine map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &handlerLine))
+	assert.Equal(t, "handler", handlerLine["msg"])
+	assert.Equal(t, "abc", handlerLine["request_id"])
+	assert.Equal(t, "/items/:id", handlerLine["route"])
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 1, "skipped routes are not logged")
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "abc", entry["request_id"])
+	assert.Equal(t, "/items/:id", entry["route"])
+	assert.Equal(t, float64(http.StatusOK), entry["status"])
+	assert.Equal(t, float64(4), entry["bytes_in"])
+	assert.Equal(t, float64(4), entry["bytes_out"])
+	assert.Equal(t, "user_service", entry["upstream"])
+	assert.Equal(t, "MISS", entry["cache"])
+	assert.NotContains(t, entry, "query")
+}
+
+func TestLogger_Combined(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	r := newLoggedRouter(t, logging.Discard(), &config.LogConfig{
+		SuccessSampleRate: 0,
+		Access:            config.AccessLogConfig{Format: "combined", Output: path},
+	})
+
+	serve(r, http.MethodGet, "/items/1", nil)
+	serve(r, http.MethodGet, "/fail?x=1", http.Header{"User-Agent": {"test-agent"}, "Referer": {"http://example.com/"}})
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 1, "successful requests are sampled out, failures are not")
+	assert.Regexp(t, `^192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /fail\?x=1 HTTP/1\.1" 400 - "http://example\.com/" "test-agent"$`, lines[0])
+}
@@ -1,88 +1,289 @@
 package middleware
 
 import (
-	"fmt"
+	"context"
+	"hash/maphash"
+	"log/slog"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"api-gateway/config"
+	"api-gateway/internal/logging"
+	"api-gateway/internal/models/responses"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
 )
 
+// defaultRateLimitShards is the number of independently locked shards used
+// to store client limiters
+const defaultRateLimitShards = 32
+
+// Clock provides the current time, allowing tests to control time
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
 // Define a struct to hold client's rate limiter and last seen time
 type client struct {
 	limiter  *rate.Limiter
 	lastSeen time.Time
 }
 
-// Create a map to store client rate limiters and configuration
-var (
-	clients = make(map[string]*client)
+// limiterShard holds a subset of the clients guarded by its own mutex
+type limiterShard struct {
 	mu      sync.Mutex
-	cfg     *config.RateLimitConfig
-)
+	clients map[string]*client
+}
+
+// RateLimiter limits requests per client using a token bucket per key
+type RateLimiter struct {
+	cfg    atomic.Pointer[config.RateLimitConfig]
+	clock  Clock
+	seed   maphash.Seed
+	shards []*limiterShard
+
+	onReject func() // Called for every rejected request, may be nil
+	logger   *slog.Logger
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// RateLimiterOption configures optional RateLimiter behaviour
+type RateLimiterOption func(*RateLimiter)
+
+// WithClock sets the clock used for token accounting and cleanup
+func WithClock(clock Clock) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.clock = clock
+	}
+}
+
+// WithShards sets the number of shards used to store client limiters
+func WithShards(n int) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		if n > 0 {
+			rl.shards = make([]*limiterShard, n)
+		}
+	}
+}
+
+// WithLogger sets the logger used by the cleanup routine
+func WithLogger(logger *slog.Logger) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.logger = logger
+	}
+}
+
+// WithRejectHook sets a function called whenever the middleware rejects a
+// request, for example to count rejections
+func WithRejectHook(fn func()) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.onReject = fn
+	}
+}
+
+// NewRateLimiter creates a rate limiter and starts its cleanup routine.
+// The routine stops when ctx is cancelled or Close is called.
+func NewRateLimiter(ctx context.Context, cfg *config.RateLimitConfig, opts ...RateLimiterOption) *RateLimiter {
+	rl := &RateLimiter{
+		clock:  systemClock{},
+		logger: logging.Discard(),
+		seed:   maphash.MakeSeed(),
+		shards: make([]*limiterShard, defaultRateLimitShards),
+		done:   make(chan struct{}),
+	}
+	rl.cfg.Store(cfg)
+	for _, opt := range opts {
+		opt(rl)
+	}
+	for i := range rl.shards {
+		rl.shards[i] = &limiterShard{clients: make(map[string]*client)}
+	}
+
+	ctx, rl.cancel = context.WithCancel(ctx)
+	go rl.cleanupRoutine(ctx)
+
+	return rl
+}
+
+// Close stops the cleanup routine and waits for it to exit
+func (rl *RateLimiter) Close() error {
+	rl.cancel()
+	<-rl.done
+	return nil
+}
 
-// InitRateLimit initializes the rate limiter with configuration
-func InitRateLimit(config *config.RateLimitConfig) {
-	cfg = config
-	// Start cleanup routine
-	go cleanupRoutine()
+// Reconfigure applies new limits to new and already tracked clients. Tokens
+// clients have left are kept, up to the new burst size.
+func (rl *RateLimiter) Reconfigure(cfg *config.RateLimitConfig) {
+	rl.cfg.Store(cfg)
+	if cfg.RequestsPerMinute <= 0 {
+		return
+	}
+
+	now := rl.clock.Now()
+	limit := limitPerMinute(cfg.RequestsPerMinute)
+	for _, shard := range rl.shards {
+		shard.mu.Lock()
+		for _, c := range shard.clients {
+			c.limiter.SetLimitAt(now, limit)
+			c.limiter.SetBurstAt(now, cfg.BurstSize)
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// limitPerMinute converts a number of requests per minute to a rate
+func limitPerMinute(n int) rate.Limit {
+	return rate.Every(time.Minute / time.Duration(n))
+}
+
+// cleanupInterval returns how often idle clients are removed
+func (rl *RateLimiter) cleanupInterval() time.Duration {
+	cfg := rl.cfg.Load()
+	if cfg.CleanupInterval <= 0 {
+		return time.Minute
+	}
+	return time.Duration(cfg.CleanupInterval) * time.Minute
 }
 
 // cleanupRoutine periodically cleans up old rate limiters
-func cleanupRoutine() {
+func (rl *RateLimiter) cleanupRoutine(ctx context.Context) {
+	defer close(rl.done)
+
+	ticker := time.NewTicker(rl.cleanupInterval())
+	defer ticker.Stop()
+
 	for {
-		fmt.Println("cleanupRoutine")
-		time.Sleep(time.Duration(cfg.CleanupInterval) * time.Minute)
-		mu.Lock()
-		for ip, client := range clients {
-			if time.Since(client.lastSeen) > time.Duration(cfg.CleanupInterval)*time.Minute {
-				delete(clients, ip)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed := rl.Cleanup()
+			rl.logger.Debug("rate limiter cleanup", "removed", removed, "clients", rl.Len())
+			// Pick up a reconfigured interval
+			ticker.Reset(rl.cleanupInterval())
+		}
+	}
+}
+
+// Cleanup removes clients that have not been seen for a cleanup interval
+// and returns how many were removed
+func (rl *RateLimiter) Cleanup() int {
+	removed := 0
+	cutoff := rl.clock.Now().Add(-rl.cleanupInterval())
+	for _, shard := range rl.shards {
+		shard.mu.Lock()
+		for key, c := range shard.clients {
+			if c.lastSeen.Before(cutoff) {
+				delete(shard.clients, key)
+				removed++
 			}
 		}
-		mu.Unlock()
+		shard.mu.Unlock()
+	}
+	return removed
+}
+
+// Len returns the number of tracked clients
+func (rl *RateLimiter) Len() int {
+	n := 0
+	for _, shard := range rl.shards {
+		shard.mu.Lock()
+		n += len(shard.clients)
+		shard.mu.Unlock()
+	}
+	return n
+}
+
+// RateLimitEntry describes the bucket of a tracked client
+type RateLimitEntry struct {
+	Key      string
+	Tokens   float64 // Requests the client can make right now
+	LastSeen time.Time
+}
+
+// Entries returns the buckets of every tracked client
+func (rl *RateLimiter) Entries() []RateLimitEntry {
+	now := rl.clock.Now()
+	var entries []RateLimitEntry
+	for _, shard := range rl.shards {
+		shard.mu.Lock()
+		for key, c := range shard.clients {
+			entries = append(entries, RateLimitEntry{
+				Key:      key,
+				Tokens:   c.limiter.TokensAt(now),
+				LastSeen: c.lastSeen,
+			})
+		}
+		shard.mu.Unlock()
 	}
+	return entries
 }
 
-// getClientLimiter returns a rate limiter for the provided IP address
-func getClientLimiter(ip string) *rate.Limiter {
-	mu.Lock()
-	defer mu.Unlock()
+// Forget drops the bucket of a client, restoring its full burst. It reports
+// whether the client was tracked.
+func (rl *RateLimiter) Forget(key string) bool {
+	shard := rl.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	_, ok := shard.clients[key]
+	delete(shard.clients, key)
+	return ok
+}
+
+// shardFor returns the shard responsible for the given key
+func (rl *RateLimiter) shardFor(key string) *limiterShard {
+	return rl.shards[maphash.String(rl.seed, key)%uint64(len(rl.shards))]
+}
 
-	if c, exists := clients[ip]; exists {
-		c.lastSeen = time.Now()
-		return c.limiter
+// Allow reports whether a request for the given key is allowed now
+func (rl *RateLimiter) Allow(key string) bool {
+	cfg := rl.cfg.Load()
+	if cfg.RequestsPerMinute <= 0 {
+		return true
 	}
 
-	// Create a new rate limiter using configured values
-	limiter := rate.NewLimiter(rate.Every(time.Minute/time.Duration(cfg.RequestsPerMinute)), cfg.BurstSize)
-	clients[ip] = &client{
-		limiter:  limiter,
-		lastSeen: time.Now(),
+	now := rl.clock.Now()
+	shard := rl.shardFor(key)
+
+	shard.mu.Lock()
+	c, exists := shard.clients[key]
+	if !exists {
+		// Create a new rate limiter using configured values
+		c = &client{
+			limiter: rate.NewLimiter(limitPerMinute(cfg.RequestsPerMinute), cfg.BurstSize),
+		}
+		shard.clients[key] = c
 	}
+	c.lastSeen = now
+	shard.mu.Unlock()
 
-	return limiter
+	return c.limiter.AllowN(now, 1)
 }
 
-// RateLimit middleware for gin
-func RateLimit() gin.HandlerFunc {
+// Middleware returns the gin middleware limiting requests by client IP
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Check if rate limit is configured
-		if cfg == nil {
+		// Background cache refreshes were already counted for the client
+		if isCacheRefresh(c.Request) {
 			c.Next()
 			return
 		}
 
-		ip := c.ClientIP()
-		limiter := getClientLimiter(ip)
-
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Too many requests. Please try again later.",
-			})
+		if !rl.Allow(c.ClientIP()) {
+			if rl.onReject != nil {
+				rl.onReject()
+			}
+			c.JSON(http.StatusTooManyRequests, responses.NewError(c.Request.Context(), "Too many requests. Please try again later."))
 			c.Abort()
 			return
 		}
@@ -0,0 +1,171 @@
+package middleware_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"api-gateway/config"
+	"api-gateway/internal/middleware"
+)
+
+// fakeClock is a manually advanced clock
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestRateLimiter(t testing.TB, cfg *config.RateLimitConfig, clock middleware.Clock) *middleware.RateLimiter {
+	rl := middleware.NewRateLimiter(context.Background(), cfg, middleware.WithClock(clock))
+	t.Cleanup(func() { rl.Close() })
+	return rl
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rl := newTestRateLimiter(t, &config.RateLimitConfig{
+		RequestsPerMinute: 60,
+		BurstSize:         2,
+		CleanupInterval:   5,
+	}, clock)
+
+	assert.True(t, rl.Allow("10.0.0.1"))
+	assert.True(t, rl.Allow("10.0.0.1"))
+	assert.False(t, rl.Allow("10.0.0.1"), "burst should be exhausted")
+	assert.True(t, rl.Allow("10.0.0.2"), "clients are limited independently")
+
+	clock.Advance(time.Second)
+	assert.True(t, rl.Allow("10.0.0.1"), "one token is refilled per second")
+	assert.False(t, rl.Allow("10.0.0.1"))
+}
+
+func TestRateLimiter_Reconfigure(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rl := newTestRateLimiter(t, &config.RateLimitConfig{
+		RequestsPerMinute: 60,
+		BurstSize:         1,
+		CleanupInterval:   5,
+	}, clock)
+
+	assert.True(t, rl.Allow("10.0.0.1"))
+	assert.False(t, rl.Allow("10.0.0.1"))
+
+	rl.Reconfigure(&config.RateLimitConfig{
+		RequestsPerMinute: 120,
+		BurstSize:         3,
+		CleanupInterval:   5,
+	})
+	clock.Advance(time.Second)
+	assert.True(t, rl.Allow("10.0.0.1"), "tracked clients refill at the new rate")
+	assert.True(t, rl.Allow("10.0.0.1"))
+	assert.False(t, rl.Allow("10.0.0.1"))
+
+	assert.True(t, rl.Allow("10.0.0.2"))
+	assert.True(t, rl.Allow("10.0.0.2"))
+	assert.True(t, rl.Allow("10.0.0.2"), "new clients get the new burst")
+	assert.False(t, rl.Allow("10.0.0.2"))
+}
+
+func TestRateLimiter_Cleanup(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rl := newTestRateLimiter(t, &config.RateLimitConfig{
+		RequestsPerMinute: 60,
+		BurstSize:         1,
+		CleanupInterval:   5,
+	}, clock)
+
+	rl.Allow("10.0.0.1")
+	clock.Advance(4 * time.Minute)
+	rl.Allow("10.0.0.2")
+	assert.Equal(t, 2, rl.Len())
+
+	clock.Advance(2 * time.Minute)
+	rl.Cleanup()
+	assert.Equal(t, 1, rl.Len(), "only the idle client should be removed")
+}
+
+func TestRateLimiter_ZeroRateDisablesLimiting(t *testing.T) {
+	rl := newTestRateLimiter(t, &config.RateLimitConfig{}, &fakeClock{})
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, rl.Allow("10.0.0.1"))
+	}
+}
+
+func TestRateLimiter_CloseStopsCleanup(t *testing.T) {
+	rl := middleware.NewRateLimiter(context.Background(), &config.RateLimitConfig{CleanupInterval: 1})
+
+	done := make(chan struct{})
+	go func() {
+		rl.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not stop the cleanup routine")
+	}
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rl := newTestRateLimiter(t, &config.RateLimitConfig{
+		RequestsPerMinute: 60,
+		BurstSize:         1,
+	}, &fakeClock{})
+
+	router := gin.New()
+	router.Use(rl.Middleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func BenchmarkRateLimiter_Allow(b *testing.B) {
+	for _, shards := range []int{1, 32} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			rl := middleware.NewRateLimiter(context.Background(), &config.RateLimitConfig{
+				RequestsPerMinute: 1 << 20,
+				BurstSize:         1 << 20,
+				CleanupInterval:   5,
+			}, middleware.WithShards(shards))
+			defer rl.Close()
+
+			var n atomic.Uint64
+			b.RunParallel(func(pb *testing.PB) {
+				id := n.Add(1)
+				key := fmt.Sprintf("10.0.%d.%d", id/256, id%256)
+				for pb.Next() {
+					rl.Allow(key)
+				}
+			})
+		})
+	}
+}
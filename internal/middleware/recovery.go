@@ -1,11 +1,13 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
 	"runtime/debug"
 
 	"github.com/gin-gonic/gin"
+
+	"api-gateway/internal/logging"
+	"api-gateway/internal/requestid"
 )
 
 // Recovery returns a middleware that recovers from panics and converts them to APIResponse
@@ -14,14 +16,17 @@ func Recovery() gin.HandlerFunc {
 		defer func() {
 			if err := recover(); err != nil {
 				// Log the stack trace
-				stack := string(debug.Stack())
-				fmt.Printf("Recovery from panic: %v\nStack trace:\n%s\n", err, stack)
+				logging.FromContext(c.Request.Context()).Error("recovered from panic",
+					"error", err,
+					"stack", string(debug.Stack()),
+				)
 
 				// Only attempt to send error response if headers haven't been written
 				if !c.Writer.Written() {
 					c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
-						"message": "Request could not be processed",
-						"code":    http.StatusUnprocessableEntity,
+						"message":    "Request could not be processed",
+						"code":       http.StatusUnprocessableEntity,
+						"request_id": requestid.FromContext(c.Request.Context()),
 					})
 				} else {
 					// If headers were already written, just abort
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"api-gateway/internal/requestid"
+)
+
+// RequestID is a middleware that identifies every request by the ID the
+// client sent in header, or a generated UUIDv7 when it sent none or an
+// invalid one. The ID is stored in the request context, under "request_id"
+// in the gin context and returned in the same response header.
+func RequestID(header string) gin.HandlerFunc {
+	if header == "" {
+		header = requestid.DefaultHeader
+	}
+	return func(c *gin.Context) {
+		id := c.GetHeader(header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(requestid.WithContext(c.Request.Context(), header, id))
+		c.Header(header, id)
+		c.Next()
+	}
+}
@@ -0,0 +1,84 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/internal/middleware"
+	"api-gateway/internal/models/responses"
+	utilhttp "api-gateway/internal/utils/http"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Upstream records the request ID it receives
+	var upstreamID string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamID = r.Header.Get("X-Correlation-ID")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+	sender := utilhttp.NewHTTPSender(upstream.URL, 0)
+
+	r := gin.New()
+	r.Use(middleware.RequestID("X-Correlation-ID"))
+	r.GET("/proxy", func(c *gin.Context) {
+		require.NoError(t, sender.Get(c.Request.Context(), "/", nil))
+		c.Status(http.StatusOK)
+	})
+	r.GET("/admin", middleware.RequireRole("admin"))
+
+	t.Run("generated", func(t *testing.T) {
+		w := serve(r, http.MethodGet, "/proxy", nil)
+		id, err := uuid.Parse(w.Header().Get("X-Correlation-ID"))
+		require.NoError(t, err)
+		assert.Equal(t, uuid.Version(7), id.Version())
+		assert.Equal(t, id.String(), upstreamID)
+	})
+
+	t.Run("accepted", func(t *testing.T) {
+		w := serve(r, http.MethodGet, "/proxy", http.Header{"X-Correlation-Id": {"client-id-1"}})
+		assert.Equal(t, "client-id-1", w.Header().Get("X-Correlation-ID"))
+		assert.Equal(t, "client-id-1", upstreamID)
+	})
+
+	t.Run("invalid replaced", func(t *testing.T) {
+		w := serve(r, http.MethodGet, "/proxy", http.Header{"X-Correlation-Id": {"has spaces"}})
+		assert.NotEqual(t, "has spaces", w.Header().Get("X-Correlation-ID"))
+		assert.NotEmpty(t, w.Header().Get("X-Correlation-ID"))
+	})
+
+	t.Run("error body", func(t *testing.T) {
+		w := serve(r, http.MethodGet, "/admin", http.Header{"X-Correlation-Id": {"client-id-2"}})
+		require.Equal(t, http.StatusForbidden, w.Code)
+		var body responses.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, "client-id-2", body.RequestID)
+	})
+}
+
+func TestRequestID_NotReplayedFromCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rc := middleware.NewResponseCache(testCacheConfig(), middleware.NewMemoryStore(1<<20))
+
+	r := gin.New()
+	r.Use(middleware.RequestID(""))
+	r.Use(rc.Middleware())
+	r.GET("/items/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "item")
+	})
+
+	first := serve(r, http.MethodGet, "/items/1", http.Header{"X-Request-Id": {"first"}})
+	second := serve(r, http.MethodGet, "/items/1", http.Header{"X-Request-Id": {"second"}})
+	require.Equal(t, "HIT", second.Header().Get("X-Cache"))
+	assert.Equal(t, "first", first.Header().Get("X-Request-ID"))
+	assert.Equal(t, "second", second.Header().Get("X-Request-ID"))
+}
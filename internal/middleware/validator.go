@@ -5,6 +5,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+
+	"api-gateway/internal/models/responses"
+	"api-gateway/internal/requestid"
 )
 
 var validate = validator.New()
@@ -13,9 +16,7 @@ var validate = validator.New()
 func ValidateRequest(model interface{}) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if err := c.ShouldBindJSON(&model); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Invalid request payload",
-			})
+			c.JSON(http.StatusBadRequest, responses.NewError(c.Request.Context(), "Invalid request payload"))
 			c.Abort()
 			return
 		}
@@ -27,7 +28,8 @@ func ValidateRequest(model interface{}) gin.HandlerFunc {
 					errors[i] = e.Field() + " " + e.Tag()
 				}
 				c.JSON(http.StatusBadRequest, gin.H{
-					"errors": errors,
+					"errors":     errors,
+					"request_id": requestid.FromContext(c.Request.Context()),
 				})
 				c.Abort()
 				return
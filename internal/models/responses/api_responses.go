@@ -1,13 +1,29 @@
 package responses
 
+import (
+	"context"
+	"time"
+
+	"api-gateway/internal/audit"
+	"api-gateway/internal/requestid"
+	utilhttp "api-gateway/internal/utils/http"
+)
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error string `json:"error" example:"error message"`
+	Error     string `json:"error" example:"error message"`
+	RequestID string `json:"request_id,omitempty" example:"01928c3e-8d6a-7c4b-9f1e-2a3b4c5d6e7f"`
+}
+
+// NewError creates an error response identifying the request of ctx
+func NewError(ctx context.Context, message string) ErrorResponse {
+	return ErrorResponse{Error: message, RequestID: requestid.FromContext(ctx)}
 }
 
 // HealthResponse represents a health check response
 type HealthResponse struct {
-	Status string `json:"status" example:"ok"`
+	Status string            `json:"status" example:"ok"`
+	Checks map[string]string `json:"checks,omitempty"`
 }
 
 // MessageResponse represents a simple message response
@@ -21,3 +37,50 @@ type APIResponse[T any] struct {
 	Message string `json:"message"`
 	Code    int    `json:"code"`
 }
+
+// PurgeResponse represents the result of a cache purge
+type PurgeResponse struct {
+	Purged int64 `json:"purged" example:"3"`
+}
+
+// AuditEventsResponse represents audit events, newest first
+type AuditEventsResponse struct {
+	Events []audit.Event `json:"events"`
+}
+
+// RouteResponse describes a route served by the gateway
+type RouteResponse struct {
+	Method  string `json:"method" example:"GET"`
+	Path    string `json:"path" example:"/api/users/:id"`
+	Handler string `json:"handler"`
+}
+
+// RoutesResponse represents the route table
+type RoutesResponse struct {
+	Routes []RouteResponse `json:"routes"`
+}
+
+// UpstreamsResponse represents the upstream services and their health
+type UpstreamsResponse struct {
+	Upstreams []utilhttp.UpstreamStatus `json:"upstreams"`
+}
+
+// RateLimitEntry represents the rate limiter bucket of a tracked client
+type RateLimitEntry struct {
+	Key      string    `json:"key" example:"203.0.113.7"`
+	Tokens   float64   `json:"tokens" example:"42.5"` // Requests the client can make right now
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// RateLimitEntriesResponse represents the rate limiter buckets of tracked clients
+type RateLimitEntriesResponse struct {
+	Entries []RateLimitEntry `json:"entries"`
+}
+
+// CacheStatsResponse represents the response cache activity and contents
+type CacheStatsResponse struct {
+	Store     string            `json:"store" example:"redis"`
+	Results   map[string]uint64 `json:"results"`              // GET requests by X-Cache value
+	L1Entries int               `json:"l1_entries,omitempty"` // Items in the in-process cache
+	L1Bytes   int               `json:"l1_bytes,omitempty"`
+}
@@ -0,0 +1,219 @@
+// Package proxyproto accepts connections prefixed with a PROXY protocol v1
+// or v2 header, as sent by L4 load balancers such as HAProxy or AWS NLB, and
+// reports the client address the header carries as the remote address.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHeaderTimeout bounds reading the header of a new connection
+const DefaultHeaderTimeout = 5 * time.Second
+
+// ErrNoHeader is returned for connections not starting with a PROXY header
+var ErrNoHeader = errors.New("proxyproto: connection does not start with a PROXY header")
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// v1MaxLength is the longest v1 header, CRLF included
+const v1MaxLength = 107
+
+// Listener wraps a listener whose connections must start with a PROXY
+// header
+type Listener struct {
+	net.Listener
+	HeaderTimeout time.Duration // 0 means DefaultHeaderTimeout
+}
+
+// NewListener requires a PROXY header on every connection accepted by ln
+func NewListener(ln net.Listener) *Listener {
+	return &Listener{Listener: ln, HeaderTimeout: DefaultHeaderTimeout}
+}
+
+// Accept returns the next connection. Its header is read on first use, in
+// the goroutine serving it, so a slow client cannot stall Accept.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	timeout := l.HeaderTimeout
+	if timeout <= 0 {
+		timeout = DefaultHeaderTimeout
+	}
+	return &Conn{Conn: conn, r: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Conn is a connection whose remote and local addresses come from its
+// PROXY header
+type Conn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+
+	once   sync.Once
+	err    error
+	remote net.Addr // nil for LOCAL or UNKNOWN headers
+	local  net.Addr
+}
+
+// Read reads data following the header
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the client address from the header, or the address of
+// the peer when the header carries none
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address from the header, or the local
+// address of the connection when the header carries none
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// readHeader reads the header within the timeout. A connection with an
+// invalid header fails every read.
+func (c *Conn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	sig, err := c.r.Peek(len(v2Signature))
+	switch {
+	case err == nil && bytes.Equal(sig, v2Signature):
+		c.remote, c.local, c.err = readV2(c.r)
+	case len(sig) >= len(v1Prefix) && bytes.Equal(sig[:len(v1Prefix)], v1Prefix):
+		c.remote, c.local, c.err = readV1(c.r)
+	case err != nil && len(sig) < len(v1Prefix):
+		c.err = fmt.Errorf("proxyproto: reading header: %w", err)
+	default:
+		c.err = ErrNoHeader
+	}
+	if c.err != nil {
+		c.Conn.Close()
+	}
+}
+
+// readV1 parses a text header such as
+// "PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\r\n"
+func readV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("proxyproto: reading v1 header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	header, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, nil, errors.New("proxyproto: v1 header too long or not terminated by CRLF")
+	}
+
+	fields := strings.Split(header, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("proxyproto: invalid v1 header %q", header)
+	}
+	src, err := v1Addr(fields[2], fields[4], fields[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := v1Addr(fields[3], fields[5], fields[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func v1Addr(host, port, family string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || (family == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("proxyproto: invalid %s address %q", family, host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("proxyproto: invalid port %q", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readV2 parses a binary header. Addresses of families other than TCP or
+// UDP over IPv4 and IPv6, and TLVs, are skipped.
+func readV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, nil, fmt.Errorf("proxyproto: reading v2 header: %w", err)
+	}
+	if version := fixed[12] >> 4; version != 2 {
+		return nil, nil, fmt.Errorf("proxyproto: unsupported version %d", version)
+	}
+	command := fixed[12] & 0x0f
+	family := fixed[13]
+	body := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, fmt.Errorf("proxyproto: reading v2 addresses: %w", err)
+	}
+
+	switch command {
+	case 0x0: // LOCAL: health checks from the load balancer itself
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("proxyproto: unsupported command %d", command)
+	}
+
+	var ipLen int
+	switch family >> 4 {
+	case 0x1: // AF_INET
+		ipLen = net.IPv4len
+	case 0x2: // AF_INET6
+		ipLen = net.IPv6len
+	default:
+		return nil, nil, nil
+	}
+	if len(body) < 2*ipLen+4 {
+		return nil, nil, errors.New("proxyproto: v2 address block too short")
+	}
+	src := &net.TCPAddr{
+		IP:   net.IP(body[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(body[2*ipLen:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(body[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(body[2*ipLen+2:])),
+	}
+	return src, dst, nil
+}
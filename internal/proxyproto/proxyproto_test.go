@@ -0,0 +1,115 @@
+package proxyproto_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/internal/proxyproto"
+)
+
+// accept sends data over a new connection to a PROXY protocol listener and
+// returns the accepted connection
+func accept(t *testing.T, data []byte) (net.Conn, net.Conn) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln := proxyproto.NewListener(inner)
+	ln.HeaderTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { ln.Close() })
+
+	client, err := net.Dial("tcp", inner.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	_, err = client.Write(data)
+	require.NoError(t, err)
+
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, client
+}
+
+// v2Header builds a binary header of a PROXY command
+func v2Header(family byte, addrs []byte) []byte {
+	header := []byte("\r\n\r\n\x00\r\nQUIT\n\x21")
+	header = append(header, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addrs)))
+	return append(header, addrs...)
+}
+
+func readAll(t *testing.T, conn net.Conn, n int) string {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	return string(buf)
+}
+
+func TestListener_V1(t *testing.T) {
+	conn, _ := accept(t, []byte("PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\r\nGET / HTTP/1.1\r\n"))
+	assert.Equal(t, "203.0.113.7:51234", conn.RemoteAddr().String())
+	assert.Equal(t, "10.0.0.1:443", conn.LocalAddr().String())
+	assert.Equal(t, "GET / HTTP/1.1\r\n", readAll(t, conn, 16))
+
+	conn, _ = accept(t, []byte("PROXY TCP6 2001:db8::7 2001:db8::1 51234 443\r\n"))
+	assert.Equal(t, "[2001:db8::7]:51234", conn.RemoteAddr().String())
+
+	// UNKNOWN keeps the address of the peer
+	conn, client := accept(t, []byte("PROXY UNKNOWN\r\nping"))
+	assert.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+	assert.Equal(t, "ping", readAll(t, conn, 4))
+}
+
+func TestListener_V2(t *testing.T) {
+	addrs := []byte{203, 0, 113, 7, 10, 0, 0, 1}
+	addrs = binary.BigEndian.AppendUint16(addrs, 51234)
+	addrs = binary.BigEndian.AppendUint16(addrs, 443)
+	addrs = append(addrs, 0x04, 0x00, 0x01, 0xff) // A TLV, skipped
+	conn, _ := accept(t, append(v2Header(0x11, addrs), "ping"...))
+	assert.Equal(t, "203.0.113.7:51234", conn.RemoteAddr().String())
+	assert.Equal(t, "10.0.0.1:443", conn.LocalAddr().String())
+	assert.Equal(t, "ping", readAll(t, conn, 4))
+
+	addrs = append(net.ParseIP("2001:db8::7"), net.ParseIP("2001:db8::1")...)
+	addrs = binary.BigEndian.AppendUint16(addrs, 51234)
+	addrs = binary.BigEndian.AppendUint16(addrs, 443)
+	conn, _ = accept(t, v2Header(0x21, addrs))
+	assert.Equal(t, "[2001:db8::7]:51234", conn.RemoteAddr().String())
+
+	// LOCAL commands, sent by load balancer health checks, carry no client
+	local := v2Header(0x00, nil)
+	local[12] = 0x20
+	conn, client := accept(t, append(local, "ping"...))
+	assert.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+	assert.Equal(t, "ping", readAll(t, conn, 4))
+}
+
+func TestListener_Invalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"no header":      "GET / HTTP/1.1\r\nHost: gateway\r\n\r\n",
+		"bad address":    "PROXY TCP4 203.0.113.256 10.0.0.1 51234 443\r\n",
+		"wrong family":   "PROXY TCP4 2001:db8::7 10.0.0.1 51234 443\r\n",
+		"bad port":       "PROXY TCP4 203.0.113.7 10.0.0.1 70000 443\r\n",
+		"not terminated": "PROXY TCP4 203.0.113.7 10.0.0.1 51234 443 ...................................................................\r\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			conn, _ := accept(t, []byte(data))
+			_, err := conn.Read(make([]byte, 1))
+			assert.Error(t, err)
+			if name == "no header" {
+				assert.ErrorIs(t, err, proxyproto.ErrNoHeader)
+			}
+		})
+	}
+
+	// Clients sending nothing are dropped after the header timeout
+	conn, _ := accept(t, nil)
+	start := time.Now()
+	_, err := conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,306 @@
+package redisclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"api-gateway/config"
+)
+
+// ErrUnavailable is returned instead of contacting Redis while it is down
+var ErrUnavailable = errors.New("redis is unavailable")
+
+// failureThreshold is the number of consecutive connection failures after
+// which Redis is considered down
+const failureThreshold = 3
+
+// Redis availability reported by Status
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+type probeKey struct{}
+
+// Client is a Redis client that tracks the availability of the server.
+// While Redis is down commands fail immediately with ErrUnavailable instead
+// of waiting for a timeout, and a background probe detects its recovery.
+type Client struct {
+	redis.UniversalClient
+	interval time.Duration
+	logger   *slog.Logger
+
+	healthy  atomic.Bool
+	failures atomic.Int32
+
+	mu      sync.Mutex
+	lastErr error
+
+	credentials atomic.Pointer[credentials] // Used by new connections
+}
+
+// credentials authenticate connections to Redis
+type credentials struct {
+	username, password string
+}
+
+// New creates a client from the Redis config. The connection is checked
+// once; an unreachable server is not an error and is retried by Monitor.
+func New(cfg *config.RedisConfig, logger *slog.Logger) (*Client, error) {
+	opts, err := universalOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		interval: cfg.HealthCheckInterval,
+		logger:   logger,
+	}
+	c.credentials.Store(&credentials{username: cfg.Username, password: cfg.Password})
+	c.UniversalClient = newUniversalClient(opts, c.currentCredentials)
+	if c.interval <= 0 {
+		c.interval = 5 * time.Second
+	}
+	c.UniversalClient.AddHook(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), max(opts.DialTimeout, time.Second))
+	defer cancel()
+	c.probe(ctx)
+	if !c.Healthy() {
+		logger.Warn("redis is unavailable, continuing without it", "error", c.Err())
+	}
+	return c, nil
+}
+
+// newUniversalClient creates the client selected by opts like
+// redis.NewUniversalClient, authenticating standalone and cluster
+// connections with the credentials returned by provider
+func newUniversalClient(opts *redis.UniversalOptions, provider func() (string, string)) redis.UniversalClient {
+	switch {
+	case opts.MasterName != "":
+		// Sentinel clients only use the credentials of their options
+		return redis.NewFailoverClient(opts.Failover())
+	case len(opts.Addrs) > 1:
+		cluster := opts.Cluster()
+		cluster.CredentialsProvider = provider
+		return redis.NewClusterClient(cluster)
+	default:
+		simple := opts.Simple()
+		simple.CredentialsProvider = provider
+		return redis.NewClient(simple)
+	}
+}
+
+// CredentialsReloadable reports whether a client created from cfg applies
+// SetCredentials. Sentinel clients keep the credentials they were created
+// with.
+func CredentialsReloadable(cfg *config.RedisConfig) bool {
+	return cfg.MasterName == ""
+}
+
+// SetCredentials sets the username and password of new connections, such
+// as after a rotated password is reloaded. Open connections stay
+// authenticated as before.
+func (c *Client) SetCredentials(username, password string) {
+	c.credentials.Store(&credentials{username: username, password: password})
+}
+
+// currentCredentials returns the credentials of new connections
+func (c *Client) currentCredentials() (string, string) {
+	creds := c.credentials.Load()
+	return creds.username, creds.password
+}
+
+// universalOptions maps the Redis config to client options. Several
+// addresses select a cluster client and a master name a sentinel client.
+func universalOptions(cfg *config.RedisConfig) (*redis.UniversalOptions, error) {
+	addrs := cfg.Addrs
+	if len(addrs) == 0 {
+		addrs = []string{net.JoinHostPort(cfg.Host, cfg.Port)}
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:        addrs,
+		DB:           cfg.DB,
+		MasterName:   cfg.MasterName,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	}
+
+	if cfg.TLS {
+		opts.TLSConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: cfg.TLSSkipVerify,
+		}
+		if cfg.TLSCAFile != "" {
+			pem, err := os.ReadFile(cfg.TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read redis CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in redis CA file %s", cfg.TLSCAFile)
+			}
+			opts.TLSConfig.RootCAs = pool
+		}
+	}
+	return opts, nil
+}
+
+// Unwrap returns the go-redis client, a *redis.ClusterClient when several
+// addresses are configured
+func (c *Client) Unwrap() redis.UniversalClient {
+	return c.UniversalClient
+}
+
+// Healthy reports whether Redis is currently reachable
+func (c *Client) Healthy() bool {
+	return c.healthy.Load()
+}
+
+// Status returns StatusUp or StatusDown
+func (c *Client) Status() string {
+	if c.Healthy() {
+		return StatusUp
+	}
+	return StatusDown
+}
+
+// Err returns the last connection error, nil while Redis is up
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastErr
+}
+
+// Monitor probes Redis every health check interval until ctx is cancelled
+func (c *Client) Monitor(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			probeCtx, cancel := context.WithTimeout(ctx, c.interval)
+			c.probe(probeCtx)
+			cancel()
+		}
+	}
+}
+
+// probe pings Redis and updates its availability
+func (c *Client) probe(ctx context.Context) {
+	c.Check(ctx)
+}
+
+// Check pings Redis, even while it is marked down, updates its availability
+// and returns the ping error
+func (c *Client) Check(ctx context.Context) error {
+	err := c.Ping(context.WithValue(ctx, probeKey{}, true)).Err()
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	if err != nil {
+		c.markDown(err)
+		return err
+	}
+	c.markUp()
+	return nil
+}
+
+func (c *Client) markUp() {
+	c.failures.Store(0)
+	if !c.healthy.Swap(true) {
+		c.mu.Lock()
+		c.lastErr = nil
+		c.mu.Unlock()
+		c.logger.Info("redis is available")
+	}
+}
+
+func (c *Client) markDown(err error) {
+	c.mu.Lock()
+	c.lastErr = err
+	c.mu.Unlock()
+	if c.healthy.Swap(false) {
+		c.logger.Warn("redis is unavailable", "error", err)
+	}
+}
+
+// record counts a command result towards the failure threshold
+func (c *Client) record(err error) {
+	if !isConnectionError(err) {
+		c.failures.Store(0)
+		return
+	}
+	if c.failures.Add(1) >= failureThreshold {
+		c.markDown(err)
+	}
+}
+
+// isConnectionError reports whether err means the server could not be
+// reached, as opposed to a reply such as redis.Nil or a command error
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var replyErr redis.Error
+	return !errors.As(err, &replyErr)
+}
+
+// allowed reports whether a command may be sent to Redis
+func (c *Client) allowed(ctx context.Context) bool {
+	probe, _ := ctx.Value(probeKey{}).(bool)
+	return probe || c.Healthy()
+}
+
+// DialHook passes dials through unchanged
+func (c *Client) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+// ProcessHook short-circuits commands while Redis is down
+func (c *Client) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !c.allowed(ctx) {
+			cmd.SetErr(ErrUnavailable)
+			return ErrUnavailable
+		}
+		err := next(ctx, cmd)
+		c.record(err)
+		return err
+	}
+}
+
+// ProcessPipelineHook short-circuits pipelines while Redis is down
+func (c *Client) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !c.allowed(ctx) {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrUnavailable)
+			}
+			return ErrUnavailable
+		}
+		err := next(ctx, cmds)
+		c.record(err)
+		return err
+	}
+}
@@ -0,0 +1,130 @@
+package redisclient_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/config"
+	"api-gateway/internal/logging"
+	"api-gateway/internal/redisclient"
+)
+
+// fakeRedis answers PING on a TCP listener, rejecting every other command
+func fakeRedis(t *testing.T, ln net.Listener) {
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					cmd, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					reply := "-ERR unknown command\r\n"
+					if strings.EqualFold(cmd, "PING") {
+						reply = "+PONG\r\n"
+					}
+					if _, err := conn.Write([]byte(reply)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+}
+
+// readCommand reads a RESP array and returns its first element
+func readCommand(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return "", err
+	}
+	var name string
+	for i := 0; i < n; i++ {
+		if _, err := r.ReadString('\n'); err != nil { // $len
+			return "", err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if i == 0 {
+			name = strings.TrimSpace(arg)
+		}
+	}
+	return name, nil
+}
+
+func TestClient_ShortCircuitsWhileDown(t *testing.T) {
+	// Reserve a port, then release it so nothing is listening
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	host, port, _ := net.SplitHostPort(addr)
+	client, err := redisclient.New(&config.RedisConfig{
+		Host:                host,
+		Port:                port,
+		DialTimeout:         100 * time.Millisecond,
+		HealthCheckInterval: 20 * time.Millisecond,
+	}, logging.Discard())
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.False(t, client.Healthy())
+	assert.Equal(t, redisclient.StatusDown, client.Status())
+	assert.ErrorIs(t, client.Get(context.Background(), "key").Err(), redisclient.ErrUnavailable)
+
+	// Start a server on the same address and wait for the probe to notice
+	ln, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+	fakeRedis(t, ln)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Monitor(ctx)
+
+	assert.Eventually(t, client.Healthy, 2*time.Second, 10*time.Millisecond)
+	assert.NoError(t, client.Ping(context.Background()).Err())
+	assert.NoError(t, client.Err())
+}
+
+func TestClient_SetCredentials(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("old-password")
+	host, port, _ := net.SplitHostPort(mr.Addr())
+	client, err := redisclient.New(&config.RedisConfig{Host: host, Port: port, Password: "old-password"}, logging.Discard())
+	require.NoError(t, err)
+	defer client.Close()
+	require.True(t, client.Healthy())
+
+	// After the password is rotated, new connections use the new one
+	mr.RequireAuth("new-password")
+	client.SetCredentials("", "new-password")
+	mr.Close()
+	require.NoError(t, mr.Restart())
+	assert.Eventually(t, func() bool { return client.Check(context.Background()) == nil }, 2*time.Second, 10*time.Millisecond)
+
+	assert.True(t, redisclient.CredentialsReloadable(&config.RedisConfig{Addrs: []string{"a:6379", "b:6379"}}))
+	assert.False(t, redisclient.CredentialsReloadable(&config.RedisConfig{MasterName: "primary"}))
+}
@@ -0,0 +1,72 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// DefaultHeader is the header carrying the request ID unless configured otherwise
+const DefaultHeader = "X-Request-ID"
+
+// maxLength bounds request IDs accepted from clients
+const maxLength = 128
+
+type contextKey struct{}
+
+// requestID is the ID of a request and the header it travels in
+type requestID struct {
+	header string
+	id     string
+}
+
+// New returns a time-ordered UUIDv7 request ID
+func New() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// Valid reports whether an ID received from a client can be used as is: it
+// must be non-empty, short and made of visible ASCII characters so it is
+// safe to log and forward
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// WithContext returns a copy of ctx carrying the request ID and the header
+// it is sent in
+func WithContext(ctx context.Context, header, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestID{header: header, id: id})
+}
+
+// FromContext returns the request ID stored in ctx, or an empty string
+func FromContext(ctx context.Context) string {
+	rid, _ := ctx.Value(contextKey{}).(requestID)
+	return rid.id
+}
+
+// HeaderFromContext returns the header the request ID stored in ctx is sent
+// in, or an empty string
+func HeaderFromContext(ctx context.Context) string {
+	rid, _ := ctx.Value(contextKey{}).(requestID)
+	return rid.header
+}
+
+// Inject sets the request ID stored in ctx on outgoing headers
+func Inject(ctx context.Context, header http.Header) {
+	if rid, ok := ctx.Value(contextKey{}).(requestID); ok {
+		header.Set(rid.header, rid.id)
+	}
+}
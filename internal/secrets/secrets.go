@@ -0,0 +1,139 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// ErrNotFound is returned when a reference points to a missing secret
+var ErrNotFound = errors.New("secret not found")
+
+// Provider resolves secret references of one scheme
+type Provider interface {
+	// Resolve returns the secret ref points to. ref is the reference
+	// without its scheme, such as /run/secrets/jwt for file:///run/secrets/jwt.
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// ProviderFunc adapts a function to a Provider
+type ProviderFunc func(ctx context.Context, ref string) (string, error)
+
+// Resolve calls f
+func (f ProviderFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// File reads secrets from files, such as Docker or Kubernetes secret
+// mounts. A single trailing newline is trimmed.
+var File = ProviderFunc(func(ctx context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), nil
+})
+
+// Env reads secrets from environment variables
+var Env = ProviderFunc(func(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%w: environment variable %s is not set", ErrNotFound, name)
+	}
+	return value, nil
+})
+
+// Resolver replaces scheme://ref references with the secrets they point to
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// NewResolver creates a resolver for file:// and env:// references
+func NewResolver() *Resolver {
+	return &Resolver{
+		providers: map[string]Provider{
+			"file": File,
+			"env":  Env,
+		},
+	}
+}
+
+// Register resolves references of scheme with p
+func (r *Resolver) Register(scheme string, p Provider) {
+	r.providers[scheme] = p
+}
+
+// Resolve returns the secret value points to, or value itself when it is
+// not a reference of a registered scheme
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return value, nil
+	}
+	p, ok := r.providers[scheme]
+	if !ok {
+		return value, nil
+	}
+	secret, err := p.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s://%s: %w", scheme, ref, err)
+	}
+	return secret, nil
+}
+
+// ResolveStruct replaces references in every string, string slice element
+// and string map value reachable from ptr, a pointer to a struct. Fields
+// are named by their mapstructure tags in the returned errors, which are
+// joined so every unresolved reference is reported.
+func (r *Resolver) ResolveStruct(ctx context.Context, ptr any) error {
+	var errs []error
+	r.walk(ctx, reflect.ValueOf(ptr).Elem(), "", &errs)
+	return errors.Join(errs...)
+}
+
+func (r *Resolver) walk(ctx context.Context, v reflect.Value, path string, errs *[]error) {
+	resolve := func(value, path string) string {
+		secret, err := r.Resolve(ctx, value)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("%s: %w", path, err))
+			return value
+		}
+		return secret
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(resolve(v.String(), path))
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+			if name == "" {
+				name = field.Name
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			r.walk(ctx, v.Field(i), name, errs)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			r.walk(ctx, v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		for _, key := range v.MapKeys() {
+			value := v.MapIndex(key).String()
+			v.SetMapIndex(key, reflect.ValueOf(resolve(value, path+"."+fmt.Sprint(key))).Convert(v.Type().Elem()))
+		}
+	}
+}
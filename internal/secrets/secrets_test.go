@@ -0,0 +1,136 @@
+package secrets_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/internal/secrets"
+)
+
+// vaultStub serves the KV secrets at /v1/<path> and counts reads
+func vaultStub(t *testing.T, token string, kv map[string]any) (*httptest.Server, *int) {
+	reads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reads++
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		data, ok := kv[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &reads
+}
+
+func TestResolver_FileAndEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt")
+	require.NoError(t, os.WriteFile(path, []byte("s3cret\n"), 0o600))
+	t.Setenv("GATEWAY_TEST_SECRET", "from-env")
+
+	r := secrets.NewResolver()
+	ctx := context.Background()
+
+	value, err := r.Resolve(ctx, "file://"+path)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", value)
+
+	value, err = r.Resolve(ctx, "env://GATEWAY_TEST_SECRET")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", value)
+
+	value, err = r.Resolve(ctx, "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", value, "unregistered schemes are plain values")
+
+	_, err = r.Resolve(ctx, "env://GATEWAY_TEST_MISSING")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+}
+
+func TestResolver_ResolveStruct(t *testing.T) {
+	t.Setenv("GATEWAY_TEST_SECRET", "from-env")
+
+	type nested struct {
+		Token string `mapstructure:"token"`
+	}
+	var cfg struct {
+		Name     string            `mapstructure:"name"`
+		Nested   nested            `mapstructure:"nested"`
+		List     []string          `mapstructure:"list"`
+		Services map[string]string `mapstructure:"services"`
+		Missing  string            `mapstructure:"missing"`
+		Port     int               `mapstructure:"port"`
+	}
+	cfg.Name = "gateway"
+	cfg.Nested.Token = "env://GATEWAY_TEST_SECRET"
+	cfg.List = []string{"a", "env://GATEWAY_TEST_SECRET"}
+	cfg.Services = map[string]string{"token": "env://GATEWAY_TEST_SECRET"}
+	cfg.Missing = "env://GATEWAY_TEST_MISSING"
+
+	err := secrets.NewResolver().ResolveStruct(context.Background(), &cfg)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+	assert.Contains(t, err.Error(), "missing:")
+
+	assert.Equal(t, "gateway", cfg.Name)
+	assert.Equal(t, "from-env", cfg.Nested.Token)
+	assert.Equal(t, []string{"a", "from-env"}, cfg.List)
+	assert.Equal(t, "from-env", cfg.Services["token"])
+}
+
+func TestVault_KV2(t *testing.T) {
+	srv, reads := vaultStub(t, "root", map[string]any{
+		"/v1/secret/data/gateway": map[string]any{
+			"data":     map[string]any{"jwt": "vault-secret", "port": 6379},
+			"metadata": map[string]any{"version": 3},
+		},
+	})
+	r := secrets.NewResolver()
+	r.Register("vault", secrets.NewVault(secrets.VaultOptions{Address: srv.URL, Token: "root", KVVersion: 2}))
+	ctx := context.Background()
+
+	value, err := r.Resolve(ctx, "vault://secret/gateway#jwt")
+	require.NoError(t, err)
+	assert.Equal(t, "vault-secret", value)
+
+	value, err = r.Resolve(ctx, "vault://secret/gateway#port")
+	require.NoError(t, err)
+	assert.Equal(t, "6379", value)
+	assert.Equal(t, 1, *reads, "keys of one path are read once")
+
+	_, err = r.Resolve(ctx, "vault://secret/gateway#missing")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+
+	_, err = r.Resolve(ctx, "vault://secret/other#jwt")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+
+	_, err = r.Resolve(ctx, "vault://secret/gateway")
+	assert.Error(t, err, "references must name a key")
+}
+
+func TestVault_KV1(t *testing.T) {
+	srv, _ := vaultStub(t, "root", map[string]any{
+		"/v1/kv/gateway": map[string]any{"password": "hunter2"},
+	})
+
+	value, err := secrets.NewVault(secrets.VaultOptions{Address: srv.URL, Token: "root", KVVersion: 1}).
+		Resolve(context.Background(), "kv/gateway#password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", value)
+
+	_, err = secrets.NewVault(secrets.VaultOptions{Address: srv.URL, Token: "wrong", KVVersion: 1}).
+		Resolve(context.Background(), "kv/gateway#password")
+	assert.ErrorContains(t, err, "status 403")
+}
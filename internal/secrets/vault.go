@@ -0,0 +1,134 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultOptions configures a Vault KV secrets engine client
+type VaultOptions struct {
+	Address   string // Server URL, such as https://vault:8200
+	Token     string
+	Namespace string        // Enterprise namespace, empty for the root namespace
+	KVVersion int           // 1 or 2
+	Timeout   time.Duration // Per request, 0 for no timeout
+}
+
+// Vault resolves mount/path#key references against a Vault compatible KV
+// secrets engine. Secrets read are cached for the life of the provider, so
+// several keys of one path cost one request.
+type Vault struct {
+	opts   VaultOptions
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]map[string]any
+}
+
+// NewVault creates a Vault provider
+func NewVault(opts VaultOptions) *Vault {
+	return &Vault{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		cache:  make(map[string]map[string]any),
+	}
+}
+
+// Resolve returns the key of the secret at mount/path, given as
+// mount/path#key. The first path segment is the mount of the engine.
+func (v *Vault) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || key == "" {
+		return "", fmt.Errorf("vault reference must name a key: mount/path#key")
+	}
+
+	data, err := v.read(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("%w: key %s is not in %s", ErrNotFound, key, path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	// Non-string values are returned as JSON
+	b, _ := json.Marshal(value)
+	return string(b), nil
+}
+
+// read returns the key-value pairs stored at path
+func (v *Vault) read(ctx context.Context, path string) (map[string]any, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if data, ok := v.cache[path]; ok {
+		return data, nil
+	}
+
+	mount, rest, _ := strings.Cut(strings.Trim(path, "/"), "/")
+	apiPath := "/v1/" + mount + "/" + rest
+	if v.opts.KVVersion != 1 {
+		apiPath = "/v1/" + mount + "/data/" + rest
+	}
+	u, err := url.JoinPath(v.opts.Address, apiPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault address: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.opts.Token)
+	if v.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.opts.Namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("vault returned status %d for %s", resp.StatusCode, path)
+	}
+
+	// KV version 2 nests the secret in data.data, next to its metadata
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	raw := body.Data
+	if v.opts.KVVersion != 1 {
+		var nested struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &nested); err != nil {
+			return nil, fmt.Errorf("failed to decode vault response: %w", err)
+		}
+		raw = nested.Data
+	}
+	var data map[string]any
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	if data == nil {
+		// Deleted KV version 2 secrets have null data
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+
+	v.cache[path] = data
+	return data, nil
+}
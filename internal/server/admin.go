@@ -0,0 +1,72 @@
+package server
+
+import (
+	"api-gateway/config"
+	"api-gateway/internal/handlers"
+	"api-gateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAdminEngine builds the admin API router, served on its own listener
+// and guarded by the admin token rather than JWTs
+func (s *Server) newAdminEngine(cfg *config.Config) *gin.Engine {
+	engine := gin.New()
+	// Admin clients connect directly, forwarding headers are not believed
+	engine.ForwardedByClientIP = false
+	engine.Use(middleware.RequestID(cfg.Server.RequestIDHeader))
+	engine.Use(middleware.Logger(s.logger, nil))
+	engine.Use(middleware.Recovery())
+
+	adminHandler := handlers.NewAdminHandler(s, s.upstreams, s.rateLimiter, s.cache)
+
+	admin := engine.Group("/admin")
+	// Record actions taken through the admin API, including refused ones
+	if s.auditor != nil {
+		admin.Use(s.auditor.Middleware())
+	}
+	admin.Use(middleware.StaticToken(cfg.Admin.Token))
+	{
+		admin.GET("/config", adminHandler.Config)
+		admin.GET("/readyz", handlers.NewHealthHandler(s.checker, nil).Readyz)
+		admin.GET("/routes", adminHandler.Routes)
+		if s.metrics != nil {
+			admin.GET("/metrics", s.metrics.Handler())
+		}
+
+		admin.GET("/upstreams", adminHandler.Upstreams)
+		admin.POST("/upstreams/:name/drain", adminHandler.DrainUpstream)
+		admin.POST("/upstreams/:name/resume", adminHandler.ResumeUpstream)
+		admin.POST("/upstreams/:name/breaker/reset", adminHandler.ResetBreaker)
+
+		admin.GET("/ratelimit", adminHandler.RateLimitEntries)
+		admin.DELETE("/ratelimit", adminHandler.ResetRateLimit)
+
+		admin.GET("/cache", adminHandler.CacheStats)
+		admin.DELETE("/cache/keys", s.cacheHandler.PurgeKey)
+		admin.DELETE("/cache/prefixes", s.cacheHandler.PurgePrefix)
+		admin.DELETE("/cache/tags/:tag", s.cacheHandler.PurgeTag)
+
+		if s.auditHandler != nil {
+			admin.GET("/audit", s.auditHandler.ListEvents)
+		}
+	}
+
+	return engine
+}
+
+// CurrentConfig returns the configuration currently applied
+func (s *Server) CurrentConfig() *config.Config {
+	return s.current.Load().config
+}
+
+// Routes returns the routes of the current snapshot
+func (s *Server) Routes() gin.RoutesInfo {
+	return s.current.Load().engine.Routes()
+}
+
+// AdminRouter returns the admin API router, nil when the admin API is
+// disabled
+func (s *Server) AdminRouter() *gin.Engine {
+	return s.adminEngine
+}
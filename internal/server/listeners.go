@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"api-gateway/config"
+	"api-gateway/internal/certs"
+	"api-gateway/internal/proxyproto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listener is an address the gateway is served on
+type listener struct {
+	config config.ListenerConfig
+	certs  *certs.Store // nil when TLS is disabled
+
+	server *http.Server // Set by Start
+	addr   net.Addr     // Bound by Start
+}
+
+// profile returns the middleware profile of the listener
+func (l *listener) profile() string {
+	if l.config.Profile == "" {
+		return config.ProfilePublic
+	}
+	return l.config.Profile
+}
+
+// bind opens the listener: a TCP address or a Unix socket, expecting a
+// PROXY header on each connection when configured
+func (l *listener) bind() (net.Listener, error) {
+	cfg := l.config
+	var ln net.Listener
+	var err error
+	if cfg.Network == "unix" {
+		ln, err = listenUnix(cfg.Address, cfg.SocketMode)
+	} else {
+		ln, err = net.Listen("tcp", cfg.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The header precedes the TLS handshake
+	if cfg.ProxyProtocol {
+		ln = proxyproto.NewListener(ln)
+	}
+	return ln, nil
+}
+
+// listenUnix listens on the socket at path, replacing a socket left behind
+// by a previous run, and sets its permissions to mode when not empty
+func listenUnix(path, mode string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err == nil {
+			err = os.Chmod(path, fs.FileMode(perm))
+		}
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+		}
+	}
+	return ln, nil
+}
+
+// profileKey is the context key of the profile of the listener a request
+// arrived on
+type profileKey struct{}
+
+// withProfile returns a copy of ctx carrying a listener profile
+func withProfile(ctx context.Context, profile string) context.Context {
+	return context.WithValue(ctx, profileKey{}, profile)
+}
+
+// profileOf returns the profile of the listener the request of ctx arrived
+// on, public when unknown
+func profileOf(ctx context.Context) string {
+	if profile, ok := ctx.Value(profileKey{}).(string); ok && profile != "" {
+		return profile
+	}
+	return config.ProfilePublic
+}
+
+// publicOnly runs h for requests arriving on public listeners only
+func publicOnly(h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if profileOf(c.Request.Context()) == config.ProfileInternal {
+			c.Next()
+			return
+		}
+		h(c)
+	}
+}
+
+// internalOnly runs h for requests arriving on internal listeners only,
+// answering others as if the route did not exist
+func internalOnly(h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if profileOf(c.Request.Context()) != config.ProfileInternal {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		h(c)
+	}
+}
+
+// newListeners loads the certificates of the configured listeners, reloading
+// them when they change until ctx is cancelled
+func (s *Server) newListeners(ctx context.Context, cfg *config.ServerConfig) ([]*listener, error) {
+	var listeners []*listener
+	for _, lc := range cfg.EffectiveListeners() {
+		l := &listener{config: lc}
+		if lc.TLS.Enabled {
+			var err error
+			if l.certs, err = certs.NewStore(lc.TLS.Certificates, s.logger); err != nil {
+				return nil, fmt.Errorf("listener %s: %w", lc.Name, err)
+			}
+			if err := l.certs.Watch(ctx); err != nil {
+				return nil, fmt.Errorf("listener %s: %w", lc.Name, err)
+			}
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// redirectToHTTPS returns a handler permanently redirecting every request
+// to the same URL over HTTPS on httpsPort
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		// Joining keeps IPv6 addresses in brackets, even without the port
+		host = net.JoinHostPort(strings.Trim(host, "[]"), httpsPort)
+		if httpsPort == "443" {
+			host = strings.TrimSuffix(host, ":443")
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
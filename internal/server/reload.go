@@ -0,0 +1,128 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"api-gateway/config"
+	"api-gateway/internal/middleware"
+	"api-gateway/internal/redisclient"
+)
+
+// Reload applies a validated configuration without a restart. Routes, CORS,
+// trusted proxies, upstream clients, rate limits and the JWT secret switch
+// atomically: in-flight requests finish on the previous snapshot. If the
+// new snapshot cannot be built, the current configuration stays in effect.
+// Rotated Redis credentials are used by new connections. Changes to
+// settings that require a restart are logged and ignored, the snapshot
+// keeping the values the server was created with.
+func (s *Server) Reload(cfg *config.Config) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	// Periodic secret refreshes usually find nothing changed
+	if reflect.DeepEqual(cfg, s.loaded) {
+		s.logger.Debug("configuration unchanged")
+		return nil
+	}
+
+	applied := keepRestartSettings(cfg, s.config)
+	snap, err := s.newSnapshot(applied)
+	if err != nil {
+		return fmt.Errorf("failed to apply configuration: %w", err)
+	}
+
+	// Changes are reported by the reload making them only, and changes
+	// reverted to the running values not at all
+	pending := restartRequired(s.loaded, cfg)
+	var keys []string
+	for _, key := range restartRequired(s.config, cfg) {
+		if slices.Contains(pending, key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) > 0 {
+		s.logger.Warn("configuration changes ignored until restart", "keys", keys)
+	}
+
+	if s.redis != nil && redisclient.CredentialsReloadable(&applied.Redis) {
+		s.redis.SetCredentials(applied.Redis.Username, applied.Redis.Password)
+	}
+	s.rateLimiter.Reconfigure(&applied.RateLimit)
+	middleware.SetJWTSecret(applied.JWT.Secret)
+	old := s.current.Swap(snap)
+	s.loaded = cfg
+
+	// Connections in use by the replaced user service finish their requests
+	// and are closed by the idle timeout
+	old.userService.CloseIdleConnections()
+
+	s.logger.Info("configuration reloaded")
+	return nil
+}
+
+// restartSettings are the config keys that only take effect when the
+// server is created, with a function returning a pointer to their value
+var restartSettings = []struct {
+	key   string
+	field func(cfg *config.Config) any
+}{
+	{"server.port", func(cfg *config.Config) any { return &cfg.Server.Port }},
+	{"server.mode", func(cfg *config.Config) any { return &cfg.Server.Mode }},
+	{"server.read_timeout", func(cfg *config.Config) any { return &cfg.Server.ReadTimeout }},
+	{"server.read_header_timeout", func(cfg *config.Config) any { return &cfg.Server.ReadHeaderTimeout }},
+	{"server.write_timeout", func(cfg *config.Config) any { return &cfg.Server.WriteTimeout }},
+	{"server.idle_timeout", func(cfg *config.Config) any { return &cfg.Server.IdleTimeout }},
+	{"server.max_header_bytes", func(cfg *config.Config) any { return &cfg.Server.MaxHeaderBytes }},
+	{"server.tls", func(cfg *config.Config) any { return &cfg.Server.TLS }},
+	{"server.listeners", func(cfg *config.Config) any { return &cfg.Server.Listeners }},
+	{"server.http2", func(cfg *config.Config) any { return &cfg.Server.HTTP2 }},
+	{"log", func(cfg *config.Config) any { return &cfg.Log }},
+	{"redis", func(cfg *config.Config) any { return &cfg.Redis }},
+	{"cache", func(cfg *config.Config) any { return &cfg.Cache }},
+	{"metrics", func(cfg *config.Config) any { return &cfg.Metrics }},
+	{"tracing", func(cfg *config.Config) any { return &cfg.Tracing }},
+	{"audit", func(cfg *config.Config) any { return &cfg.Audit }},
+	{"admin", func(cfg *config.Config) any { return &cfg.Admin }},
+	{"health", func(cfg *config.Config) any { return &cfg.Health }},
+}
+
+// restartRequired returns the config keys changed between old and new that
+// only take effect when the server is created
+func restartRequired(old, new *config.Config) []string {
+	// Rotated Redis credentials are applied by the client
+	o, n := *old, *new
+	o.Redis, n.Redis = redisRestartSettings(o.Redis), redisRestartSettings(n.Redis)
+
+	var keys []string
+	for _, setting := range restartSettings {
+		if !reflect.DeepEqual(setting.field(&o), setting.field(&n)) {
+			keys = append(keys, setting.key)
+		}
+	}
+	return keys
+}
+
+// keepRestartSettings returns a copy of cfg with the settings that require
+// a restart taken from running, the configuration the server was created
+// with, so the snapshot reflects what is in effect
+func keepRestartSettings(cfg, running *config.Config) *config.Config {
+	kept := *cfg
+	for _, setting := range restartSettings {
+		reflect.ValueOf(setting.field(&kept)).Elem().Set(reflect.ValueOf(setting.field(running)).Elem())
+	}
+	if redisclient.CredentialsReloadable(&running.Redis) {
+		kept.Redis.Username, kept.Redis.Password = cfg.Redis.Username, cfg.Redis.Password
+	}
+	return &kept
+}
+
+// redisRestartSettings returns the Redis config without the credentials
+// the client applies on reload
+func redisRestartSettings(cfg config.RedisConfig) config.RedisConfig {
+	if redisclient.CredentialsReloadable(&cfg) {
+		cfg.Username, cfg.Password = "", ""
+	}
+	return cfg
+}
@@ -2,184 +2,701 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"api-gateway/config"
+	"api-gateway/internal/audit"
+	"api-gateway/internal/clientip"
 	"api-gateway/internal/handlers"
+	"api-gateway/internal/health"
+	"api-gateway/internal/logging"
+	"api-gateway/internal/metrics"
 	"api-gateway/internal/middleware"
-	"api-gateway/internal/models/responses"
+	"api-gateway/internal/redisclient"
 	"api-gateway/internal/services"
+	"api-gateway/internal/tracing"
+	utilhttp "api-gateway/internal/utils/http"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	engine      *gin.Engine
+	// config is the configuration the server was created with. Settings
+	// that can be reloaded are read from the current snapshot instead.
+	config       *config.Config
+	logger       *slog.Logger
+	testHandler  *handlers.TestHandler
+	cacheHandler *handlers.CacheHandler
+	auditHandler *handlers.AuditHandler // nil when auditing is disabled
+	auditor      *audit.Auditor         // nil when auditing is disabled
+	rateLimiter  *middleware.RateLimiter
+	cache        *middleware.ResponseCache
+	redis        *redisclient.Client   // nil unless the cache or audit trail use Redis
+	metrics      *metrics.Metrics      // nil when metrics are disabled
+	accessLog    *logging.AccessLogger // nil when access logging is disabled
+
+	// shutdownTracing flushes pending spans, nil when tracing is disabled
+	shutdownTracing func(context.Context) error
+
+	// current holds the routes built from the latest configuration
+	current  atomic.Pointer[snapshot]
+	reloadMu sync.Mutex     // Serializes reloads
+	loaded   *config.Config // The configuration last loaded, as given to Reload
+
+	upstreams *utilhttp.Upstreams // Shared by every snapshot
+
+	checker       *health.Checker
+	healthHandler *handlers.HealthHandler
+
+	adminEngine *gin.Engine  // nil when the admin API is disabled
+	adminServer *http.Server // nil when the admin API is disabled
+
+	listeners      []*listener  // In configured order
+	redirectServer *http.Server // nil unless redirecting to HTTPS
+
+	// cancel stops background routines started by New, tracked by
+	// background
+	cancel     context.CancelFunc
+	background sync.WaitGroup
+
+	adminAddr    net.Addr   // Bound by Start, nil when the admin API is disabled
+	redirectAddr net.Addr   // Bound by Start, nil unless redirecting to HTTPS
+	errs         chan error // Listener failures after Start
+}
+
+// snapshot is the part of the server rebuilt when the configuration is
+// reloaded. Requests run to completion on the snapshot they started on.
+type snapshot struct {
 	config      *config.Config
-	userHandler *handlers.UserHandler
-	testHandler *handlers.TestHandler
-	httpServer  *http.Server
+	engine      *gin.Engine
+	userService *services.UserService
 }
 
-// New creates a new server instance with middleware
-func New(cfg *config.Config) (*Server, error) {
+// New creates a new server instance with middleware, logging through logger
+func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
+
+	// Initialize tracing
+	var shutdownTracing func(context.Context) error
+	if cfg.Tracing.Enabled {
+		var err error
+		if shutdownTracing, err = tracing.Setup(context.Background(), &cfg.Tracing); err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize metrics
+	var m *metrics.Metrics
+	var upstreamObserver utilhttp.Observer
+	rateLimitOpts := []middleware.RateLimiterOption{middleware.WithLogger(logger)}
+	if cfg.Metrics.Enabled {
+		m = metrics.New()
+		upstreamObserver = m
+		rateLimitOpts = append(rateLimitOpts, middleware.WithRejectHook(m.RateLimited))
+	}
+
+	// Initialize the access log
+	var accessLog *logging.AccessLogger
+	if cfg.Log.Access.Enabled {
+		var err error
+		if accessLog, err = logging.NewAccessLogger(&cfg.Log); err != nil {
+			return nil, err
+		}
+	}
 
 	// Initialize services
-	userService := services.NewUserService(cfg.ExternalServices.UserService)
 	testService := services.NewTestService()
 
 	// Create handlers
-	userHandler := handlers.NewUserHandler(userService)
 	testHandler := handlers.NewTestHandler(testService)
 
 	// Set Gin mode
+	gin.SetMode(cfg.Server.Mode)
+
+	// Connect to Redis when the cache or the audit trail use it
+	var redisClient *redisclient.Client
+	if usesRedis(cfg) {
+		var err error
+		if redisClient, err = redisclient.New(&cfg.Redis, logger); err != nil {
+			return nil, err
+		}
+	}
 
-	// Initialize Redis client with cache config
-	middleware.InitRedis(fmt.Sprintf("%s:%s", cfg.Redis.Host, cfg.Redis.Port), &cfg.Cache)
+	// Initialize the response cache store
+	store, err := newCacheStore(cfg, redisClient)
+	if err != nil {
+		return nil, err
+	}
+	cache := middleware.NewResponseCache(&cfg.Cache, store)
+	cacheHandler := handlers.NewCacheHandler(cache)
+
+	// Initialize the audit trail
+	var auditor *audit.Auditor
+	var auditHandler *handlers.AuditHandler
+	if cfg.Audit.Enabled {
+		auditStore, err := newAuditStore(cfg, redisClient)
+		if err != nil {
+			return nil, err
+		}
+		auditor = audit.New(&cfg.Audit, auditStore)
+		auditHandler = handlers.NewAuditHandler(auditor)
+	}
 
-	// Initialize rate limiter with config
-	middleware.InitRateLimit(&cfg.RateLimit)
+	ctx, cancel := context.WithCancel(context.Background())
 
 	// Create server instance
 	s := &Server{
-		engine:      gin.New(),
-		config:      cfg,
-		userHandler: userHandler,
-		testHandler: testHandler,
+		config:       cfg,
+		logger:       logger,
+		testHandler:  testHandler,
+		cacheHandler: cacheHandler,
+		auditHandler: auditHandler,
+		auditor:      auditor,
+		rateLimiter:  middleware.NewRateLimiter(ctx, &cfg.RateLimit, rateLimitOpts...),
+		cache:        cache,
+		redis:        redisClient,
+		metrics:      m,
+		accessLog:    accessLog,
+
+		shutdownTracing: shutdownTracing,
+		upstreams:       utilhttp.NewUpstreams(upstreamObserver),
+		checker:         health.NewChecker(),
+		cancel:          cancel,
+	}
+	// Check details are for operators, not the public
+	s.healthHandler = handlers.NewHealthHandler(s.checker, func(c *gin.Context) bool {
+		return profileOf(c.Request.Context()) == config.ProfileInternal
+	})
+
+	// Start background routines, stopped by Stop
+	s.goBackground(func() { cache.Listen(ctx) })
+	if redisClient != nil {
+		s.goBackground(func() { redisClient.Monitor(ctx) })
+	}
+
+	snap, err := s.newSnapshot(cfg)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s.current.Store(snap)
+	s.loaded = cfg
+	middleware.SetJWTSecret(cfg.JWT.Secret)
+
+	// Background refreshes are served by the current snapshot
+	cache.SetRefreshHandler(s)
+
+	// Load the certificates now so bad files fail startup, and reload them
+	// when they change
+	if s.listeners, err = s.newListeners(ctx, &cfg.Server); err != nil {
+		cancel()
+		return nil, err
+	}
+	// Room for every listener, the admin API and the redirect
+	s.errs = make(chan error, len(s.listeners)+2)
+
+	s.registerHealthChecks(cfg)
+
+	if cfg.Admin.Enabled {
+		s.adminEngine = s.newAdminEngine(cfg)
 	}
-	s.initRoutes()
 
-	// Initialize databas
 	return s, nil
 }
 
-// initDatabase initializes the database connection and sets up repositories and services
-func (s *Server) initRoutes() error {
-	gin.SetMode(s.config.Server.Mode)
+// registerHealthChecks registers the checks of Redis and the user service.
+// Checks listed in health.critical fail readiness, others degrade it.
+func (s *Server) registerHealthChecks(cfg *config.Config) {
+	s.checker.SetCacheTTL(cfg.Health.CacheTTL)
+	critical := func(name string) bool {
+		return slices.Contains(cfg.Health.Critical, name)
+	}
+	if s.redis != nil {
+		s.checker.Register(health.Check{
+			Name:     "redis",
+			Run:      s.redis.Check,
+			Timeout:  cfg.Health.Timeout,
+			Critical: critical("redis"),
+		})
+	}
+	// The user store is checked through the current snapshot so reloaded
+	// upstream settings apply. Draining it on the admin API must not take
+	// the whole gateway out of rotation.
+	s.checker.Register(health.Check{
+		Name: "user_service",
+		Run: func(ctx context.Context) error {
+			err := s.current.Load().userService.HealthCheck(ctx)
+			if errors.Is(err, utilhttp.ErrUpstreamDraining) {
+				return fmt.Errorf("%w: %w", health.ErrOutOfService, err)
+			}
+			return err
+		},
+		Timeout:  cfg.Health.Timeout,
+		Critical: critical("user_service"),
+	})
+}
+
+// usesRedis reports whether the cache or the audit trail are kept in Redis
+func usesRedis(cfg *config.Config) bool {
+	return usesRedisCache(cfg) || (cfg.Audit.Enabled && cfg.Audit.Store == "redis")
+}
+
+// usesRedisCache reports whether the response cache is kept in Redis
+func usesRedisCache(cfg *config.Config) bool {
+	return cfg.Cache.Store == "redis" || cfg.Cache.Store == ""
+}
+
+// goBackground runs fn in a goroutine that Stop waits for
+func (s *Server) goBackground(fn func()) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn()
+	}()
+}
+
+// newCacheStore creates the response cache store selected by the config
+func newCacheStore(cfg *config.Config, redisClient *redisclient.Client) (middleware.CacheStore, error) {
+	switch cfg.Cache.Store {
+	case "memory":
+		return middleware.NewMemoryStore(cfg.Cache.MemoryMaxBytes), nil
+	case "disk":
+		return middleware.NewDiskStore(cfg.Cache.DiskPath)
+	case "redis", "":
+		return middleware.NewRedisStore(redisClient), nil
+	default:
+		return nil, fmt.Errorf("unknown cache store %q", cfg.Cache.Store)
+	}
+}
+
+// newAuditStore creates the audit store selected by the config
+func newAuditStore(cfg *config.Config, redisClient *redisclient.Client) (audit.Store, error) {
+	switch cfg.Audit.Store {
+	case "file", "":
+		return audit.NewFileStore(cfg.Audit.Path)
+	case "redis":
+		return audit.NewRedisStore(redisClient, cfg.Audit.Stream), nil
+	default:
+		return nil, fmt.Errorf("unknown audit store %q", cfg.Audit.Store)
+	}
+}
+
+// newSnapshot builds the routes, middleware and upstream clients configured
+// by cfg around the components shared by every snapshot
+func (s *Server) newSnapshot(cfg *config.Config) (*snapshot, error) {
+	engine := gin.New()
+
+	// Clients behind trusted proxies are resolved by the ClientIP
+	// middleware, so gin takes the remote address as is
+	resolver, err := clientip.NewResolver(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.SetTrustedProxies(nil); err != nil {
+		return nil, fmt.Errorf("failed to configure trusted proxies: %w", err)
+	}
+
+	// Initialize services
+	breaker, err := utilhttp.ParseBreakerSettings(cfg.ExternalServices.UserService)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user service circuit breaker: %w", err)
+	}
+	s.upstreams.Add("user_service", cfg.ExternalServices.UserService["base_url"])
+	s.upstreams.SetBreaker("user_service", breaker)
+	userService, err := services.NewUserService(cfg.ExternalServices.UserService, s.upstreams)
+	if err != nil {
+		return nil, err
+	}
+	userHandler := handlers.NewUserHandler(userService)
+
+	// Identify every request first so all later middleware can refer to it
+	engine.Use(middleware.RequestID(cfg.Server.RequestIDHeader))
+	engine.Use(middleware.ClientIP(resolver))
+
+	// Tell browsers to use HTTPS only
+	servesTLS := slices.ContainsFunc(cfg.Server.EffectiveListeners(), func(l config.ListenerConfig) bool {
+		return l.TLS.Enabled
+	})
+	if servesTLS && cfg.Server.HSTS.Enabled {
+		engine.Use(middleware.HSTS(&cfg.Server.HSTS))
+	}
 
-	// Configure trusted proxies
-	s.engine.SetTrustedProxies([]string{s.config.Server.TrustedProxy})
+	// Probes skip rate limiting, caching and request logging
+	engine.GET("/livez", s.healthHandler.Livez)
+	engine.GET("/readyz", s.healthHandler.Readyz)
 
-	// Initialize JWT secret
-	middleware.SetJWTSecret(s.config.JWT.Secret)
+	// Record metrics for every request, including those rejected below
+	if s.metrics != nil {
+		engine.Use(s.metrics.Middleware())
+	}
+
+	// Trace every request, continuing the caller's trace
+	if s.shutdownTracing != nil {
+		engine.Use(tracing.Middleware())
+	}
 
-	// Configure CORS
-	s.engine.Use(cors.New(cors.Config{
-		AllowOrigins:     s.config.Server.AllowOrigins,
+	// Configure CORS for browsers reaching public listeners
+	engine.Use(publicOnly(cors.New(cors.Config{
+		AllowOrigins:     cfg.Server.AllowOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Cache-Control", "If-None-Match"},
-		ExposeHeaders:    []string{"Content-Length", "ETag"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Cache-Control", "If-None-Match", "traceparent", "tracestate", cfg.Server.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "ETag", cfg.Server.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
-	}))
+	})))
 
 	// Add middlewares
-	s.engine.Use(middleware.Recovery()) // Custom recovery middleware
-	s.engine.Use(middleware.Logger())
-	s.engine.Use(middleware.RateLimit()) // Add rate limiting middleware
-	s.engine.Use(middleware.Cache())     // Apply Redis cache middleware globally
-	s.registerHttpRoutes()
+	// The logger runs first so recovered panics are logged with the request
+	engine.Use(middleware.Logger(s.logger, s.accessLog))
+	engine.Use(middleware.Recovery())                                         // Custom recovery middleware
+	engine.Use(s.phase("rate_limit", publicOnly(s.rateLimiter.Middleware()))) // Rate limit clients of public listeners
+	engine.Use(s.phase("cache", s.cache.Middleware()))                        // Apply response cache middleware globally
+	s.registerHttpRoutes(engine, userHandler)
+
+	return &snapshot{config: cfg, engine: engine, userService: userService}, nil
+}
 
-	return nil
+// phase traces a middleware as its own span when tracing is enabled
+func (s *Server) phase(name string, h gin.HandlerFunc) gin.HandlerFunc {
+	if s.shutdownTracing == nil {
+		return h
+	}
+	return tracing.Phase(name, h)
 }
 
 // registerRoutes sets up all the routes for the server
-func (s *Server) registerHttpRoutes() {
+func (s *Server) registerHttpRoutes(engine *gin.Engine, userHandler *handlers.UserHandler) {
 	// Swagger documentation
-	s.engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("http://localhost:"+s.config.Server.Port+"/swagger/doc.json")))
+	engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("http://localhost:"+s.config.Server.Port+"/swagger/doc.json")))
 
 	// Public routes
-	// @Summary Health check
-	// @Description Check if the API is up and running
-	// @Tags health
-	// @Accept json
-	// @Produce json
-	// @Success 200 {object} responses.HealthResponse
-	// @Router /health [get]
-	s.engine.GET("/health", func(c *gin.Context) {
-		c.JSON(200, responses.HealthResponse{Status: "ok"})
-	})
+	engine.GET("/health", s.healthHandler.Health)
 
-	s.engine.GET("/test", s.testHandler.Test)
+	engine.GET("/test", s.testHandler.Test)
 
-	// API routes group
-	api := s.engine.Group("/api")
+	// Prometheus metrics, also served on the admin API
+	if s.metrics != nil {
+		handler := s.metrics.Handler()
+		if s.config.Metrics.Listen != config.MetricsListenAll {
+			handler = internalOnly(handler)
+		}
+		engine.GET(s.config.Metrics.Path, handler)
+	}
+
+	// API routes group, recording state-changing requests
+	api := engine.Group("/api")
+	if s.auditor != nil {
+		api.Use(s.auditor.Middleware())
+	}
 	{
 
 		// User routes
 		users := api.Group("/users")
 		{
-			users.POST("", s.userHandler.CreateUser)
-			users.GET("", s.userHandler.ListUsers)
+			users.POST("", userHandler.CreateUser)
+			users.GET("", userHandler.ListUsers)
 		}
 
 		// Protected user routes
-		protected := users.Use(middleware.JWTAuth())
+		protected := users.Use(s.phase("auth", middleware.JWTAuth()))
+		{
+			protected.GET("/:id", userHandler.GetUser)
+			protected.PUT("/:id", userHandler.UpdateUser)
+			protected.DELETE("/:id", userHandler.DeleteUser)
+		}
+
+		// Admin routes
+		admin := api.Group("/admin", s.phase("auth", middleware.JWTAuth()), middleware.RequireRole("admin"))
 		{
-			protected.GET("/:id", s.userHandler.GetUser)
-			protected.PUT("/:id", s.userHandler.UpdateUser)
-			protected.DELETE("/:id", s.userHandler.DeleteUser)
+			admin.DELETE("/cache/keys", s.cacheHandler.PurgeKey)
+			admin.DELETE("/cache/prefixes", s.cacheHandler.PurgePrefix)
+			admin.DELETE("/cache/tags/:tag", s.cacheHandler.PurgeTag)
+			if s.auditHandler != nil {
+				admin.GET("/audit", s.auditHandler.ListEvents)
+			}
 		}
 	}
 }
 
-// Start starts the HTTP server with graceful shutdown
+// Start binds the listeners and serves requests in the background. Bind
+// errors are returned; errors serving afterwards are sent to Err.
 func (s *Server) Start() error {
-	addr := ":" + s.config.Server.Port
+	cfg := s.config.Server
+	servers := make([]*http.Server, len(s.listeners))
+	for i, l := range s.listeners {
+		var err error
+		if servers[i], err = s.newHTTPServer(l); err != nil {
+			return err
+		}
+	}
+
+	// Bind every address before serving any, so a failure leaves none open
+	var bound []net.Listener
+	bind := func(name string, fn func() (net.Listener, error)) (net.Listener, error) {
+		ln, err := fn()
+		if err != nil {
+			for _, l := range bound {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", name, err)
+		}
+		bound = append(bound, ln)
+		return ln, nil
+	}
+	tcp := func(port string) func() (net.Listener, error) {
+		return func() (net.Listener, error) { return net.Listen("tcp", ":"+port) }
+	}
+
+	lns := make([]net.Listener, len(s.listeners))
+	for i, l := range s.listeners {
+		ln, err := bind(fmt.Sprintf("listener %s address %s", l.config.Name, l.config.Address), l.bind)
+		if err != nil {
+			return err
+		}
+		lns[i] = ln
+	}
+
+	// Serve the admin API on its own port
+	var adminLn net.Listener
+	if s.adminEngine != nil {
+		var err error
+		if adminLn, err = bind("admin port "+s.config.Admin.Port, tcp(s.config.Admin.Port)); err != nil {
+			return err
+		}
+	}
+
+	// Redirect plain HTTP to HTTPS, only offered by the default listener
+	var redirectLn net.Listener
+	if cfg.TLS.Enabled && cfg.TLS.RedirectPort != "" && len(cfg.Listeners) == 0 {
+		var err error
+		if redirectLn, err = bind("redirect port "+cfg.TLS.RedirectPort, tcp(cfg.TLS.RedirectPort)); err != nil {
+			return err
+		}
+	}
+
+	for i, l := range s.listeners {
+		l.server = servers[i]
+		l.addr = lns[i].Addr()
+		s.serve(l.server, lns[i])
+		s.logger.Info("server listening", "listener", l.config.Name, "addr", l.addr.String(),
+			"tls", l.certs != nil, "profile", l.profile(), "proxy_protocol", l.config.ProxyProtocol)
+	}
+	if adminLn != nil {
+		s.adminServer = &http.Server{
+			Handler:           s.adminEngine,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			ErrorLog:          s.errorLog(),
+		}
+		s.adminAddr = adminLn.Addr()
+		s.serve(s.adminServer, adminLn)
+		s.logger.Info("admin API listening", "addr", adminLn.Addr().String())
+	}
+	if redirectLn != nil {
+		_, httpsPort, _ := net.SplitHostPort(s.listeners[0].addr.String())
+		s.redirectServer = &http.Server{
+			Handler:           redirectToHTTPS(httpsPort),
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			ErrorLog:          s.errorLog(),
+		}
+		s.redirectAddr = redirectLn.Addr()
+		s.serve(s.redirectServer, redirectLn)
+		s.logger.Info("redirecting to HTTPS", "addr", redirectLn.Addr().String())
+	}
+	return nil
+}
 
-	// Check if port is available
-	if !isPortAvailable(s.config.Server.Port) {
-		return fmt.Errorf("port %s is already in use", s.config.Server.Port)
+// newHTTPServer creates the server of a listener, tagging its requests with
+// the listener profile
+func (s *Server) newHTTPServer(l *listener) (*http.Server, error) {
+	cfg := s.config.Server
+	profile := l.profile()
+	srv := &http.Server{
+		Handler:           s,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ErrorLog:          s.errorLog(),
+		BaseContext: func(net.Listener) context.Context {
+			return withProfile(context.Background(), profile)
+		},
+	}
+	if l.certs != nil {
+		srv.TLSConfig = l.certs.ServerConfig(&l.config.TLS)
+	}
+	if err := configureHTTP2(srv, &cfg.HTTP2); err != nil {
+		return nil, err
 	}
+	return srv, nil
+}
 
-	s.httpServer = &http.Server{
-		Addr:    addr,
-		Handler: s.engine,
+// configureHTTP2 enables HTTP/2 on srv: negotiated by ALPN when srv has a
+// TLS config, or in cleartext when h2c is enabled. Otherwise only HTTP/1.1
+// is served.
+func configureHTTP2(srv *http.Server, cfg *config.HTTP2Config) error {
+	if !cfg.Enabled {
+		// A non-nil empty map disables HTTP/2 over TLS
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		return nil
 	}
 
-	// Start server in a goroutine
+	h2s := &http2.Server{
+		MaxConcurrentStreams: cfg.MaxConcurrentStreams,
+		IdleTimeout:          srv.IdleTimeout,
+	}
+	if srv.TLSConfig != nil {
+		if err := http2.ConfigureServer(srv, h2s); err != nil {
+			return fmt.Errorf("failed to configure HTTP/2: %w", err)
+		}
+	} else if cfg.H2C {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	}
+	return nil
+}
+
+// errorLog returns the logger for connection errors such as failed TLS
+// handshakes, which clients cause and are logged as warnings
+func (s *Server) errorLog() *log.Logger {
+	return slog.NewLogLogger(s.logger.Handler(), slog.LevelWarn)
+}
+
+// serve serves srv on ln in the background, over TLS when srv has a TLS
+// config, reporting failures to Err
+func (s *Server) serve(srv *http.Server, ln net.Listener) {
 	go func() {
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+		var err error
+		if srv.TLSConfig != nil {
+			// Certificates come from the TLS config
+			err = srv.ServeTLS(ln, "", "")
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.errs <- fmt.Errorf("serving %s: %w", ln.Addr(), err)
 		}
 	}()
+}
+
+// Err receives errors that stop a listener after Start returned
+func (s *Server) Err() <-chan error {
+	return s.errs
+}
+
+// Addr returns the address of the first listener, nil before Start
+func (s *Server) Addr() net.Addr {
+	return s.listeners[0].addr
+}
 
+// ListenerAddr returns the address of the named listener, nil before Start
+// or when there is no such listener
+func (s *Server) ListenerAddr(name string) net.Addr {
+	for _, l := range s.listeners {
+		if l.config.Name == name {
+			return l.addr
+		}
+	}
 	return nil
 }
 
-// Stop gracefully shuts down the server
+// AdminAddr returns the address the admin API listens on, nil before
+// Start or when the admin API is disabled
+func (s *Server) AdminAddr() net.Addr {
+	return s.adminAddr
+}
+
+// RedirectAddr returns the address of the HTTP to HTTPS redirect listener,
+// nil before Start or when it is disabled
+func (s *Server) RedirectAddr() net.Addr {
+	return s.redirectAddr
+}
+
+// Stop gracefully shuts down the server. Readiness fails first, and new
+// requests are still served for the drain period so load balancers notice
+// before the listeners close. In-flight requests then get up to the
+// shutdown timeout to finish, after which background routines are stopped.
 func (s *Server) Stop() error {
+	cfg := s.current.Load().config.Server
+
+	// Fail readiness first so load balancers stop sending new requests
+	s.checker.SetDraining(true)
+	if cfg.DrainPeriod > 0 && s.Addr() != nil {
+		s.logger.Info("draining before shutdown", "period", cfg.DrainPeriod)
+		time.Sleep(cfg.DrainPeriod)
+	}
+
 	// Create a deadline for shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
-	// Shutdown the HTTP server
-	if err := s.httpServer.Shutdown(ctx); err != nil {
-		return fmt.Errorf("server shutdown failed: %v", err)
+	var errs []error
+	for _, l := range s.listeners {
+		if l.server == nil {
+			continue
+		}
+		if err := l.server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("listener %s shutdown failed: %w", l.config.Name, err))
+		}
+	}
+	if s.adminServer != nil {
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("admin server shutdown failed: %w", err))
+		}
+	}
+	if s.redirectServer != nil {
+		if err := s.redirectServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("redirect server shutdown failed: %w", err))
+		}
 	}
 
-	return nil
+	// Stop background routines, then release what they used
+	s.cancel()
+	s.background.Wait()
+	// Closing the cache waits for refreshes replayed through the engine
+	s.cache.Close()
+	s.rateLimiter.Close()
+	if s.auditor != nil {
+		s.auditor.Close()
+	}
+	// A Redis cache store closes the client itself
+	if s.redis != nil && !usesRedisCache(s.config) {
+		s.redis.Close()
+	}
+	if s.accessLog != nil {
+		s.accessLog.Close()
+	}
+	if s.shutdownTracing != nil {
+		if err := s.shutdownTracing(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("trace export shutdown failed: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
-// Router returns the gin router instance
-func (s *Server) Router() *gin.Engine {
-	return s.engine
+// ServeHTTP serves the request with the current snapshot
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.current.Load().engine.ServeHTTP(w, r)
 }
 
-// isPortAvailable checks if a port is available
-func isPortAvailable(port string) bool {
-	ln, err := net.Listen("tcp", ":"+port)
-	if err != nil {
-		return false
-	}
-	ln.Close()
-	return true
+// Router returns the gin router instance of the current snapshot
+func (s *Server) Router() *gin.Engine {
+	return s.current.Load().engine
 }
@@ -0,0 +1,543 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+
+	"api-gateway/config"
+	"api-gateway/internal/logging"
+	"api-gateway/internal/server"
+)
+
+// loadConfig loads a configuration keeping everything in memory, with the
+// given YAML appended
+func loadConfig(t *testing.T, extra string) *config.Config {
+	t.Setenv("APP_SERVER_MODE", "test")
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+log:
+  access:
+    enabled: false
+cache:
+  store: memory
+audit:
+  enabled: false
+metrics:
+  enabled: false
+`+extra), 0o600))
+	cfg, err := config.LoadConfig(path)
+	require.NoError(t, err)
+	return cfg
+}
+
+func get(srv http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	return w
+}
+
+func TestServer_Reload(t *testing.T) {
+	srv, err := server.New(loadConfig(t, `
+rate_limit:
+  requests_per_minute: 1
+  burst_size: 1
+`), logging.Discard())
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, get(srv, "/health", nil).Code)
+	assert.Equal(t, http.StatusTooManyRequests, get(srv, "/health", nil).Code)
+	preflight := http.Header{"Origin": {"https://app.example.com"}}
+	assert.Empty(t, get(srv, "/health", preflight).Header().Get("Access-Control-Allow-Origin"))
+
+	require.NoError(t, srv.Reload(loadConfig(t, `
+server:
+  allow_origins: ["https://app.example.com"]
+rate_limit:
+  requests_per_minute: 6000
+  burst_size: 10
+`)))
+
+	// The new rate refills the bucket of the client already tracked
+	var w *httptest.ResponseRecorder
+	assert.Eventually(t, func() bool {
+		w = get(srv, "/health", preflight)
+		return w.Code == http.StatusOK
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	// A snapshot that cannot be built leaves the current one in place
+	invalid := loadConfig(t, "")
+	invalid.Server.TrustedProxies = []string{"not-a-network"}
+	require.Error(t, srv.Reload(invalid))
+	assert.Equal(t, "https://app.example.com", get(srv, "/health", preflight).Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestServer_ReloadRestartWarnings(t *testing.T) {
+	var logs bytes.Buffer
+	srv, err := server.New(loadConfig(t, ""), slog.New(slog.NewTextHandler(&logs, nil)))
+	require.NoError(t, err)
+
+	// A change needing a restart is reported by the reload making it only
+	require.NoError(t, srv.Reload(loadConfig(t, `
+server:
+  port: "9999"
+  allow_origins: ["https://a.example.com"]
+`)))
+	require.NoError(t, srv.Reload(loadConfig(t, `
+server:
+  port: "9999"
+  allow_origins: ["https://b.example.com"]
+`)))
+	assert.Equal(t, 1, strings.Count(logs.String(), "configuration changes ignored until restart"))
+	assert.Equal(t, 2, strings.Count(logs.String(), "configuration reloaded"))
+
+	// The applied configuration keeps the running values of such settings
+	port := loadConfig(t, "").Server.Port
+	assert.Equal(t, port, srv.CurrentConfig().Server.Port)
+	assert.Equal(t, []string{"https://b.example.com"}, srv.CurrentConfig().Server.AllowOrigins)
+
+	// Reverting to the running value is not reported
+	require.NoError(t, srv.Reload(loadConfig(t, `
+server:
+  allow_origins: ["https://c.example.com"]
+`)))
+	assert.Equal(t, 1, strings.Count(logs.String(), "configuration changes ignored until restart"))
+	assert.Equal(t, 3, strings.Count(logs.String(), "configuration reloaded"))
+}
+
+func TestServer_ReloadRedisCredentials(t *testing.T) {
+	var logs bytes.Buffer
+	srv, err := server.New(loadConfig(t, ""), slog.New(slog.NewTextHandler(&logs, nil)))
+	require.NoError(t, err)
+
+	// Rotated credentials are applied, sentinel settings need a restart
+	require.NoError(t, srv.Reload(loadConfig(t, `
+redis:
+  username: gateway
+  password: rotated
+`)))
+	assert.NotContains(t, logs.String(), "configuration changes ignored until restart")
+	require.NoError(t, srv.Reload(loadConfig(t, `
+redis:
+  master_name: primary
+  username: gateway
+  password: rotated
+`)))
+	assert.Contains(t, logs.String(), "configuration changes ignored until restart")
+}
+
+func TestServer_Admin(t *testing.T) {
+	cfg := loadConfig(t, `
+admin:
+  enabled: true
+  token: admin-token
+jwt:
+  secret: jwt-secret-value
+health:
+  cache_ttl: 0s
+`)
+	cfg.Metrics.Enabled = true
+	srv, err := server.New(cfg, logging.Discard())
+	require.NoError(t, err)
+	admin := srv.AdminRouter()
+	require.NotNil(t, admin)
+	auth := http.Header{"Authorization": {"Bearer admin-token"}}
+
+	do := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, req)
+		return w
+	}
+
+	// The admin API is only served on its own listener, with its own token
+	assert.Equal(t, http.StatusNotFound, get(srv, "/admin/config", auth).Code)
+	assert.Equal(t, http.StatusUnauthorized, get(admin, "/admin/config", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, get(admin, "/admin/config", http.Header{"Authorization": {"Bearer wrong"}}).Code)
+
+	w := get(admin, "/admin/readyz?verbose", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"user_service":{"status":"ok","critical":true`)
+
+	w = get(admin, "/admin/config", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "jwt-secret-value")
+	assert.NotContains(t, w.Body.String(), "admin-token")
+	assert.Contains(t, w.Body.String(), `"request_id_header":"X-Request-ID"`)
+
+	// Metrics are served to operators rather than the public
+	assert.Equal(t, http.StatusNotFound, get(srv, "/metrics", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, get(admin, "/admin/metrics", nil).Code)
+	w = get(admin, "/admin/metrics", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `gateway_upstream_circuit_breaker_state{service="user_service",state="closed"} 1`)
+
+	w = get(admin, "/admin/routes", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"path":"/api/users/:id"`)
+
+	// Requests to a drained upstream fail fast until it is resumed, while
+	// the gateway stays ready
+	createUser := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"username":"jane","email":"jane@example.com","password":"password1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusCreated, createUser())
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/upstreams/unknown/drain").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/upstreams/user_service/drain").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, createUser())
+	assert.Contains(t, get(admin, "/admin/upstreams", auth).Body.String(), `"draining":true`)
+	assert.Equal(t, http.StatusOK, get(srv, "/readyz", nil).Code)
+	w = get(admin, "/admin/readyz?verbose", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"user_service":{"status":"draining","critical":true`)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/upstreams/user_service/resume").Code)
+	assert.Equal(t, http.StatusCreated, createUser())
+
+	// Circuit breakers are listed and can be closed by hand
+	assert.Contains(t, get(admin, "/admin/upstreams", auth).Body.String(), `"breaker":"closed"`)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/upstreams/user_service/breaker/reset").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/upstreams/unknown/breaker/reset").Code)
+
+	w = get(admin, "/admin/ratelimit", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"key":"192.0.2.1"`)
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/admin/ratelimit?key=192.0.2.1").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/admin/ratelimit?key=192.0.2.1").Code)
+
+	w = get(admin, "/admin/cache", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"store":"memory"`)
+	assert.Contains(t, w.Body.String(), `"MISS":`)
+}
+
+func TestServer_Probes(t *testing.T) {
+	srv, err := server.New(loadConfig(t, `
+rate_limit:
+  requests_per_minute: 1
+  burst_size: 1
+`), logging.Discard())
+	require.NoError(t, err)
+
+	// Probes are not rate limited
+	for range 3 {
+		assert.Equal(t, http.StatusOK, get(srv, "/livez", nil).Code)
+		w := get(srv, "/readyz", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+	}
+
+	// Check details are not shown on public listeners
+	w := get(srv, "/readyz?verbose", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+
+	w = get(srv, "/health", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"user_service":"ok"`)
+}
+
+func TestServer_HealthNotCached(t *testing.T) {
+	srv, err := server.New(loadConfig(t, ""), logging.Discard())
+	require.NoError(t, err)
+
+	for range 2 {
+		w := get(srv, "/health", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.NotEqual(t, "HIT", w.Header().Get("X-Cache"))
+	}
+}
+
+func TestServer_Lifecycle(t *testing.T) {
+	cfg := loadConfig(t, `
+server:
+  drain_period: 200ms
+  shutdown_timeout: 1s
+`)
+	cfg.Server.Port = "0"
+	srv, err := server.New(cfg, logging.Discard())
+	require.NoError(t, err)
+	require.NoError(t, srv.Start())
+	base := "http://" + srv.Addr().String()
+
+	resp, err := http.Get(base + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Binding a port in use fails synchronously
+	busy := loadConfig(t, "")
+	_, busy.Server.Port, err = net.SplitHostPort(srv.Addr().String())
+	require.NoError(t, err)
+	other, err := server.New(busy, logging.Discard())
+	require.NoError(t, err)
+	assert.ErrorContains(t, other.Start(), "failed to listen")
+	require.NoError(t, other.Stop())
+
+	// Readiness fails during the drain period while requests are still served
+	stopped := make(chan error, 1)
+	go func() { stopped <- srv.Stop() }()
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get(base + "/readyz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+	resp, err = http.Get(base + "/livez")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, <-stopped)
+	_, err = http.Get(base + "/livez")
+	assert.Error(t, err, "the listener is closed after the drain period")
+}
+
+// writeCert writes a self-signed certificate for host to dir and returns
+// its file names and a pool trusting it
+func writeCert(t *testing.T, dir, host string) (string, string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, host+".crt"), filepath.Join(dir, host+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return certFile, keyFile, pool
+}
+
+func TestServer_TLS(t *testing.T) {
+	certFile, keyFile, pool := writeCert(t, t.TempDir(), "gateway.test")
+	cfg := loadConfig(t, `
+server:
+  drain_period: 0s
+  tls:
+    enabled: true
+    min_version: "1.3"
+    redirect_port: "8081"
+    certificates:
+      - cert_file: `+certFile+`
+        key_file: `+keyFile+`
+  hsts:
+    max_age: 1h
+    include_subdomains: true
+`)
+	cfg.Server.Port, cfg.Server.TLS.RedirectPort = "0", "0"
+	srv, err := server.New(cfg, logging.Discard())
+	require.NoError(t, err)
+	require.NoError(t, srv.Start())
+	defer srv.Stop()
+	_, port, err := net.SplitHostPort(srv.Addr().String())
+	require.NoError(t, err)
+
+	// Dial the listener whatever the name resolves to, verifying the name
+	dialer := &net.Dialer{}
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: pool, ServerName: "gateway.test"},
+			ForceAttemptHTTP2: true,
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, srv.Addr().String())
+			},
+		},
+	}
+
+	resp, err := client.Get("https://gateway.test:" + port + "/livez")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, uint16(tls.VersionTLS13), resp.TLS.Version)
+	assert.Equal(t, 2, resp.ProtoMajor, "HTTP/2 is negotiated")
+	assert.Equal(t, "max-age=3600; includeSubDomains", resp.Header.Get("Strict-Transport-Security"))
+
+	// TLS 1.2 is refused
+	_, err = tls.Dial("tcp", srv.Addr().String(), &tls.Config{RootCAs: pool, ServerName: "gateway.test", MaxVersion: tls.VersionTLS12})
+	assert.Error(t, err)
+
+	// Plain HTTP is redirected
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	req, err := http.NewRequest(http.MethodGet, "http://"+srv.RedirectAddr().String()+"/api/users?page=2", nil)
+	require.NoError(t, err)
+	req.Host = "gateway.test"
+	resp, err = noFollow.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "https://gateway.test:"+port+"/api/users?page=2", resp.Header.Get("Location"))
+
+	// IPv6 hosts keep their brackets
+	for _, host := range []string{"[2001:db8::1]", "[2001:db8::1]:80"} {
+		req.Host = host
+		resp, err = noFollow.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "https://[2001:db8::1]:"+port+"/api/users?page=2", resp.Header.Get("Location"), host)
+	}
+}
+
+func TestServer_H2C(t *testing.T) {
+	cfg := loadConfig(t, `
+server:
+  drain_period: 0s
+  http2:
+    h2c: true
+`)
+	cfg.Server.Port = "0"
+	srv, err := server.New(cfg, logging.Discard())
+	require.NoError(t, err)
+	require.NoError(t, srv.Start())
+	defer srv.Stop()
+
+	// Prior knowledge cleartext HTTP/2
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get("http://" + srv.Addr().String() + "/livez")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+
+	// HTTP/1.1 clients are still served
+	resp, err = http.Get("http://" + srv.Addr().String() + "/livez")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 1, resp.ProtoMajor)
+}
+
+func TestServer_Listeners(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "gateway.sock")
+	cfg := loadConfig(t, `
+server:
+  drain_period: 0s
+  listeners:
+    - name: public
+      address: 127.0.0.1:0
+      proxy_protocol: true
+    - name: internal
+      network: unix
+      address: `+socket+`
+      socket_mode: "0600"
+      profile: internal
+rate_limit:
+  requests_per_minute: 1
+  burst_size: 1
+`)
+	cfg.Metrics.Enabled = true
+	srv, err := server.New(cfg, logging.Discard())
+	require.NoError(t, err)
+	require.NoError(t, srv.Start())
+	defer srv.Stop()
+
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	assert.Equal(t, srv.Addr(), srv.ListenerAddr("public"))
+	assert.Nil(t, srv.ListenerAddr("missing"))
+
+	// Clients behind the load balancer are told apart by their PROXY header
+	viaProxy := func(clientIP, path string) int {
+		conn, err := net.Dial("tcp", srv.ListenerAddr("public").String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = fmt.Fprintf(conn, "PROXY TCP4 %s 10.0.0.1 51234 443\r\nGET %s HTTP/1.1\r\nHost: gateway\r\nConnection: close\r\n\r\n", clientIP, path)
+		require.NoError(t, err)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.NotEqual(t, http.StatusTooManyRequests, viaProxy("203.0.113.7", "/test"))
+	assert.Equal(t, http.StatusTooManyRequests, viaProxy("203.0.113.7", "/test"))
+	assert.NotEqual(t, http.StatusTooManyRequests, viaProxy("203.0.113.8", "/test"))
+
+	// Metrics are not served to the public
+	assert.Equal(t, http.StatusNotFound, viaProxy("203.0.113.9", "/metrics"))
+
+	// Connections without the header are refused
+	resp, err := http.Get("http://" + srv.ListenerAddr("public").String() + "/livez")
+	if err == nil {
+		resp.Body.Close()
+	}
+	assert.Error(t, err)
+
+	// The internal listener is not rate limited
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	for range 3 {
+		resp, err := client.Get("http://gateway/test")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.NotEqual(t, http.StatusTooManyRequests, resp.StatusCode)
+	}
+
+	// and shows the details of readiness checks
+	resp, err = client.Get("http://gateway/readyz?verbose")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"user_service":{"status":"ok"`)
+
+	// and serves metrics
+	resp, err = client.Get("http://gateway/metrics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -1,7 +1,6 @@
 package services
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,9 +16,7 @@ func NewTestService() *TestService {
 
 // Test handles the test endpoint request
 func (h *TestService) Test(c *gin.Context) {
-	fmt.Println("Test")
 	time.Sleep(500 * time.Millisecond)
-	fmt.Println("Test2")
 	c.JSON(200, gin.H{
 		"time": time.Now(),
 		"note": "Use Cache-Control header to control caching behavior",
@@ -12,12 +12,39 @@ import (
 // UserService implements the UserService interface
 type UserService struct {
 	httpSender *http.HTTPSender
+	healthPath string
 }
 
-// NewUserService creates a new instance of UserService
-func NewUserService(config map[string]string) *UserService {
+// NewUserService creates a new instance of UserService. Upstream requests
+// are reported to observer when it is not nil and carry the configured
+// token, if any, as a bearer credential. Requests time out after the
+// timeout key, 10s by default. The protocol and connection pool follow the
+// protocol, max_idle_conns, max_conns_per_host and idle_conn_timeout keys.
+func NewUserService(config map[string]string, observer http.Observer) (*UserService, error) {
 	baseURL := config["base_url"]
-	sender := http.NewHTTPSender(baseURL, 10*time.Second)
+	timeout := 10 * time.Second
+	if v := config["timeout"]; v != "" {
+		var err error
+		if timeout, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid user service timeout: %w", err)
+		}
+	}
+	sender := http.NewHTTPSender(baseURL, timeout)
+	opts, err := http.ParseTransportOptions(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user service transport: %w", err)
+	}
+	transport, err := http.NewTransport(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user service transport: %w", err)
+	}
+	sender.SetTransport(transport)
+	if observer != nil {
+		sender.SetObserver("user_service", observer)
+	}
+	if token := config["token"]; token != "" {
+		sender.SetHeader("Authorization", "Bearer "+token)
+	}
 
 	// Enable mock mode
 	sender.EnableMockMode()
@@ -67,9 +94,26 @@ func NewUserService(config map[string]string) *UserService {
 		Data: nil,
 	})
 
+	healthPath := config["health_path"]
+	if healthPath == "" {
+		healthPath = "/health"
+	}
+
 	return &UserService{
 		httpSender: sender,
-	}
+		healthPath: healthPath,
+	}, nil
+}
+
+// CloseIdleConnections closes the idle connections to the user service,
+// once the service is replaced
+func (s *UserService) CloseIdleConnections() {
+	s.httpSender.CloseIdleConnections()
+}
+
+// HealthCheck reports whether the user service is reachable
+func (s *UserService) HealthCheck(ctx context.Context) error {
+	return s.httpSender.Check(ctx, s.healthPath)
 }
 
 // CreateUser handles user creation
@@ -15,6 +15,9 @@ type IUserService interface {
 	DeleteUser(ctx context.Context, id uint) error
 	ListUsers(ctx context.Context, page, pageSize int) ([]responses.UserResponse, error)
 
+	// HealthCheck reports whether the user store is reachable
+	HealthCheck(ctx context.Context) error
+
 	// Authentication operations can be added here later
 	// Login(ctx context.Context, req *requests.LoginRequest) (*responses.TokenResponse, error)
 	// RefreshToken(ctx context.Context, req *requests.RefreshTokenRequest) (*responses.TokenResponse, error)
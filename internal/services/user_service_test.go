@@ -0,0 +1,27 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"api-gateway/internal/services"
+)
+
+func TestNewUserService(t *testing.T) {
+	service, err := services.NewUserService(map[string]string{"base_url": "http://localhost:8081"}, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, service)
+	service.CloseIdleConnections()
+
+	// Invalid settings are reported rather than replaced by defaults
+	for _, cfg := range []map[string]string{
+		{"base_url": "http://localhost:8081", "timeout": "soon"},
+		{"base_url": "http://localhost:8081", "protocol": "spdy"},
+		{"base_url": "http://localhost:8081", "max_idle_conns": "many"},
+	} {
+		_, err := services.NewUserService(cfg, nil)
+		assert.Error(t, err, cfg)
+	}
+}
@@ -0,0 +1,98 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"api-gateway/config"
+	"api-gateway/internal/tracing"
+	utilhttp "api-gateway/internal/utils/http"
+)
+
+// setupTracing installs an in-memory exporter as the global provider
+func setupTracing(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := tracing.NewProvider(&config.TracingConfig{ServiceName: "test", SampleRatio: 1}, sdktrace.WithSyncer(exporter))
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(tracing.Propagator())
+	t.Cleanup(func() {
+		tp.Shutdown(context.Background())
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return exporter
+}
+
+func spanByName(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	require.Failf(t, "span not found", "no span named %q in %d spans", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+func TestTracing_PropagatesThroughGateway(t *testing.T) {
+	exporter := setupTracing(t)
+
+	// Upstream records the trace context it receives
+	var upstreamTraceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+	sender := utilhttp.NewHTTPSender(upstream.URL, 0)
+	sender.SetObserver("user_service", nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(tracing.Middleware())
+	r.Use(tracing.Phase("auth", func(c *gin.Context) {
+		c.Set("user_id", 42)
+		c.Next()
+	}))
+	r.GET("/users/:id", func(c *gin.Context) {
+		require.NoError(t, sender.Get(c.Request.Context(), "/users/1", nil))
+		c.Status(http.StatusOK)
+	})
+
+	const parentTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("traceparent", parentTraceparent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	server := spanByName(t, spans, "GET /users/:id")
+	auth := spanByName(t, spans, "middleware.auth")
+	client := spanByName(t, spans, "GET user_service")
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Contains(t, server.Attributes, attribute.String("http.route", "/users/:id"))
+	assert.Contains(t, server.Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+	assert.Contains(t, server.Attributes, attribute.String("enduser.id", "42"))
+
+	assert.Equal(t, server.SpanContext.SpanID(), auth.Parent.SpanID())
+	assert.Equal(t, auth.SpanContext.SpanID(), client.Parent.SpanID())
+	assert.Equal(t, trace.SpanKindClient, client.SpanKind)
+
+	// The upstream continues the client span
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+client.SpanContext.SpanID().String()+"-01", upstreamTraceparent)
+}
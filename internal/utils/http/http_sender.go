@@ -5,10 +5,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"api-gateway/internal/clientip"
+	"api-gateway/internal/logging"
+	"api-gateway/internal/requestid"
 )
 
+// tracerName identifies spans created by HTTPSender
+const tracerName = "api-gateway/http"
+
 // MockResponse represents a mock response configuration
 type MockResponse struct {
 	Data       interface{}
@@ -16,12 +31,24 @@ type MockResponse struct {
 	Error      error
 }
 
+// Observer is notified of every request sent to an upstream service
+type Observer interface {
+	// StartUpstream is called before a request is sent and returns a
+	// function called with the response status, 0 if none, and the error
+	StartUpstream(service, method string) func(status int, err error)
+}
+
 // HTTPSender handles HTTP requests
 type HTTPSender struct {
 	client   *http.Client
 	baseURL  string
 	mockMode bool
 	mockData map[string]MockResponse
+
+	header http.Header // Sent with every request, e.g. credentials
+
+	service  string
+	observer Observer
 }
 
 // NewHTTPSender creates a new instance of HTTPSender
@@ -33,7 +60,40 @@ func NewHTTPSender(baseURL string, timeout time.Duration) *HTTPSender {
 		baseURL:  baseURL,
 		mockMode: false,
 		mockData: make(map[string]MockResponse),
+		header:   make(http.Header),
+	}
+}
+
+// SetHeader sets a header sent with every request to the upstream
+func (s *HTTPSender) SetHeader(name, value string) {
+	s.header.Set(name, value)
+}
+
+// SetTransport sets the round tripper used to reach the upstream, such as
+// one created by NewTransport
+func (s *HTTPSender) SetTransport(rt http.RoundTripper) {
+	s.client.Transport = rt
+}
+
+// CloseIdleConnections closes the connections to the upstream that are not
+// in use
+func (s *HTTPSender) CloseIdleConnections() {
+	s.client.CloseIdleConnections()
+}
+
+// SetObserver reports requests to the upstream named service to observer
+func (s *HTTPSender) SetObserver(service string, observer Observer) {
+	s.service = service
+	s.observer = observer
+}
+
+// upstreamName names the upstream in access logs: the service set with
+// SetObserver, or the base URL
+func (s *HTTPSender) upstreamName() string {
+	if s.service != "" {
+		return s.service
 	}
+	return s.baseURL
 }
 
 // EnableMockMode enables mock mode and initializes mock data
@@ -52,8 +112,72 @@ func (s *HTTPSender) SetMockResponse(method, path string, response MockResponse)
 	s.mockData[key] = response
 }
 
-// SendRequest sends an HTTP request and returns the response
-func (s *HTTPSender) SendRequest(ctx context.Context, method, path string, body interface{}, response interface{}) error {
+// Check sends a GET request to path, such as a health endpoint, and
+// returns an error unless the upstream answers with a status below 500.
+// Checks are not reported to the observer. In mock mode the upstream is
+// always healthy.
+func (s *HTTPSender) Check(ctx context.Context, path string) error {
+	if d, ok := s.observer.(interface{ Draining(service string) bool }); ok && d.Draining(s.service) {
+		return ErrUpstreamDraining
+	}
+	if s.mockMode {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range s.header {
+		req.Header[name] = values
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SendRequest sends an HTTP request and returns the response. The request
+// is traced as a client span and carries the trace context, request ID and
+// forwarding headers to the upstream. GET requests are conditional when ctx
+// has a Revalidation, returning ErrNotModified if the upstream answers 304.
+// Requests the observer does not admit, such as to a drained upstream, fail
+// without being sent.
+func (s *HTTPSender) SendRequest(ctx context.Context, method, path string, body interface{}, response interface{}) (err error) {
+	name := method
+	if s.service != "" {
+		name += " " + s.service
+	}
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.URLFull(s.baseURL+path),
+			attribute.Bool("gateway.mock", s.mockMode),
+		),
+	)
+	logging.RecordUpstream(ctx, s.upstreamName())
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	// Drained upstreams and open circuit breakers refuse requests
+	if a, ok := s.observer.(interface{ Admit(service string) error }); ok {
+		if err := a.Admit(s.service); err != nil {
+			return fmt.Errorf("%s: %w", s.upstreamName(), err)
+		}
+	}
+
 	if s.mockMode {
 		key := fmt.Sprintf("%s:%s", method, path)
 		if mockResp, exists := s.mockData[key]; exists {
@@ -82,7 +206,8 @@ func (s *HTTPSender) SendRequest(ctx context.Context, method, path string, body
 
 	url := fmt.Sprintf("%s%s", s.baseURL, path)
 
-	var reqBody *bytes.Buffer
+	// A nil *bytes.Buffer would be a non-nil io.Reader, so keep the interface nil
+	var reqBody io.Reader
 	if body != nil {
 		jsonData, err := json.Marshal(body)
 		if err != nil {
@@ -96,26 +221,63 @@ func (s *HTTPSender) SendRequest(ctx context.Context, method, path string, body
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
+	for name, values := range s.header {
+		req.Header[name] = values
+	}
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	requestid.Inject(ctx, req.Header)
+	clientip.Inject(ctx, req.Header)
+
+	// Revalidate the stored response the request repeats
+	rv := revalidationFrom(ctx)
+	conditional := false
+	if rv != nil && method == http.MethodGet {
+		conditional = rv.prepare(req.Header)
+	}
+
+	done := func(int, error) {}
+	if s.observer != nil {
+		done = s.observer.StartUpstream(s.service, method)
+	}
 
 	resp, err := s.client.Do(req)
 	if err != nil {
+		done(0, err)
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+
+	if rv != nil && method == http.MethodGet && (resp.StatusCode < 300 || resp.StatusCode == http.StatusNotModified) {
+		rv.record(resp)
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		if !conditional {
+			err := fmt.Errorf("unexpected status code %d for an unconditional request", resp.StatusCode)
+			done(resp.StatusCode, err)
+			return err
+		}
+		done(resp.StatusCode, nil)
+		return ErrNotModified
+	}
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		err := fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		done(resp.StatusCode, err)
+		return err
 	}
 
 	if response != nil {
 		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			done(resp.StatusCode, err)
 			return fmt.Errorf("failed to decode response: %w", err)
 		}
 	}
 
+	done(resp.StatusCode, nil)
 	return nil
 }
 
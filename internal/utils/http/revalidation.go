@@ -0,0 +1,92 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrNotModified is returned for a conditional GET the upstream answered
+// with 304 Not Modified
+var ErrNotModified = errors.New("upstream response not modified")
+
+// Validators identify a version of an upstream response
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// IsZero reports whether there are no validators
+func (v Validators) IsZero() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+// Revalidation makes the GET request an HTTPSender sends in its context
+// conditional on the validators of a stored response, and records the
+// validators of the response received
+type Revalidation struct {
+	send Validators
+
+	mu       sync.Mutex
+	requests int
+	received Validators
+}
+
+type revalidationKey struct{}
+
+// WithRevalidation returns a copy of ctx in which GET requests are sent
+// with send as If-None-Match and If-Modified-Since, and the Revalidation
+// recording the response
+func WithRevalidation(ctx context.Context, send Validators) (context.Context, *Revalidation) {
+	rv := &Revalidation{send: send}
+	return context.WithValue(ctx, revalidationKey{}, rv), rv
+}
+
+// Received returns the validators of the upstream response. They are zero
+// unless exactly one GET request was sent, as the response then depends on
+// that request only.
+func (rv *Revalidation) Received() Validators {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	if rv.requests != 1 {
+		return Validators{}
+	}
+	return rv.received
+}
+
+// revalidationFrom returns the revalidation of ctx, nil if there is none
+func revalidationFrom(ctx context.Context) *Revalidation {
+	rv, _ := ctx.Value(revalidationKey{}).(*Revalidation)
+	return rv
+}
+
+// prepare sets the conditional headers of a GET request and reports
+// whether any were set
+func (rv *Revalidation) prepare(header http.Header) bool {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.requests++
+	// Only the first request repeats the one the stored response came from
+	if rv.requests > 1 || rv.send.IsZero() {
+		return false
+	}
+	if rv.send.ETag != "" {
+		header.Set("If-None-Match", rv.send.ETag)
+	}
+	if rv.send.LastModified != "" {
+		header.Set("If-Modified-Since", rv.send.LastModified)
+	}
+	return true
+}
+
+// record keeps the validators of a response, those sent when a 304 does
+// not repeat them
+func (rv *Revalidation) record(resp *http.Response) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.received = Validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if resp.StatusCode == http.StatusNotModified && rv.received.IsZero() {
+		rv.received = rv.send
+	}
+}
@@ -0,0 +1,60 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	utilhttp "api-gateway/internal/utils/http"
+)
+
+func TestHTTPSender_Revalidation(t *testing.T) {
+	// The upstream serves version "v1" and honors If-None-Match
+	var gotINM, gotIMS string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotINM, gotIMS = r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 05 Oct 2026 10:00:00 GMT")
+		if gotINM == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer upstream.Close()
+	sender := utilhttp.NewHTTPSender(upstream.URL, 0)
+
+	// Unconditional requests record the validators of the response
+	ctx, rv := utilhttp.WithRevalidation(context.Background(), utilhttp.Validators{})
+	var body map[string]any
+	require.NoError(t, sender.Get(ctx, "/", &body))
+	assert.Empty(t, gotINM)
+	received := rv.Received()
+	assert.Equal(t, utilhttp.Validators{ETag: `"v1"`, LastModified: "Mon, 05 Oct 2026 10:00:00 GMT"}, received)
+
+	// The stored validators are sent and a 304 is reported
+	ctx, rv = utilhttp.WithRevalidation(context.Background(), received)
+	assert.ErrorIs(t, sender.Get(ctx, "/", &body), utilhttp.ErrNotModified)
+	assert.Equal(t, `"v1"`, gotINM)
+	assert.Equal(t, "Mon, 05 Oct 2026 10:00:00 GMT", gotIMS)
+	assert.Equal(t, received, rv.Received())
+
+	// Only the first request is conditional, and the response of several
+	// requests has no validators of its own
+	require.NoError(t, sender.Get(ctx, "/", &body))
+	assert.Empty(t, gotINM)
+	assert.True(t, rv.Received().IsZero())
+
+	// A 304 to a request that was not conditional is an error
+	notModified := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer notModified.Close()
+	err := utilhttp.NewHTTPSender(notModified.URL, 0).Get(context.Background(), "/", &body)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, utilhttp.ErrNotModified)
+}
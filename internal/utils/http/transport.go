@@ -0,0 +1,97 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Upstream protocols
+const (
+	ProtocolAuto  = "auto"  // HTTP/2 when negotiated over TLS, HTTP/1.1 otherwise
+	ProtocolHTTP1 = "http1" // HTTP/1.1 only
+	ProtocolHTTP2 = "http2" // HTTP/2 over TLS only
+	ProtocolH2C   = "h2c"   // HTTP/2 over cleartext TCP, for internal services
+)
+
+// TransportOptions configures the connections to an upstream
+type TransportOptions struct {
+	Protocol        string
+	MaxIdleConns    int           // Idle connections kept, 0 for the default of 100
+	MaxConnsPerHost int           // Connections including active ones, 0 for no limit
+	IdleConnTimeout time.Duration // How long idle connections are kept, 0 for 90s
+}
+
+// ParseTransportOptions reads the protocol, max_idle_conns,
+// max_conns_per_host and idle_conn_timeout keys of an upstream config
+func ParseTransportOptions(cfg map[string]string) (TransportOptions, error) {
+	opts := TransportOptions{Protocol: cfg["protocol"]}
+	if opts.Protocol == "" {
+		opts.Protocol = ProtocolAuto
+	}
+
+	var err error
+	if v := cfg["max_idle_conns"]; v != "" {
+		if opts.MaxIdleConns, err = strconv.Atoi(v); err != nil {
+			return opts, fmt.Errorf("invalid max_idle_conns: %w", err)
+		}
+	}
+	if v := cfg["max_conns_per_host"]; v != "" {
+		if opts.MaxConnsPerHost, err = strconv.Atoi(v); err != nil {
+			return opts, fmt.Errorf("invalid max_conns_per_host: %w", err)
+		}
+	}
+	if v := cfg["idle_conn_timeout"]; v != "" {
+		if opts.IdleConnTimeout, err = time.ParseDuration(v); err != nil {
+			return opts, fmt.Errorf("invalid idle_conn_timeout: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// NewTransport creates the round tripper for an upstream speaking the
+// protocol of opts
+func NewTransport(opts TransportOptions) (http.RoundTripper, error) {
+	idleTimeout := opts.IdleConnTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = 90 * time.Second
+	}
+
+	switch opts.Protocol {
+	case ProtocolH2C:
+		// Connections are multiplexed, so pool limits do not apply
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			IdleConnTimeout: idleTimeout,
+		}, nil
+	case ProtocolHTTP2:
+		return &http2.Transport{IdleConnTimeout: idleTimeout}, nil
+	case ProtocolAuto, ProtocolHTTP1, "":
+	default:
+		return nil, fmt.Errorf("unknown upstream protocol %q", opts.Protocol)
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.IdleConnTimeout = idleTimeout
+	t.MaxConnsPerHost = opts.MaxConnsPerHost
+	if opts.MaxIdleConns > 0 {
+		t.MaxIdleConns = opts.MaxIdleConns
+	}
+	// Every sender talks to a single host
+	t.MaxIdleConnsPerHost = t.MaxIdleConns
+	if opts.Protocol == ProtocolHTTP1 {
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t, nil
+}
@@ -0,0 +1,86 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	utilhttp "api-gateway/internal/utils/http"
+)
+
+// protoServer answers with the protocol version the request arrived with
+func protoServer(t *testing.T, tls bool) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"proto":"` + r.Proto + `"}`))
+	})
+	var srv *httptest.Server
+	if tls {
+		srv = httptest.NewUnstartedServer(handler)
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+	} else {
+		srv = httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestNewTransport_Protocols(t *testing.T) {
+	tests := []struct {
+		protocol string
+		tls      bool
+		want     string
+	}{
+		{utilhttp.ProtocolAuto, false, "HTTP/1.1"},
+		{utilhttp.ProtocolHTTP1, false, "HTTP/1.1"},
+		{utilhttp.ProtocolH2C, false, "HTTP/2.0"},
+		{utilhttp.ProtocolAuto, true, "HTTP/2.0"},
+		{utilhttp.ProtocolHTTP1, true, "HTTP/1.1"},
+		{utilhttp.ProtocolHTTP2, true, "HTTP/2.0"},
+	}
+	for _, tt := range tests {
+		srv := protoServer(t, tt.tls)
+		transport, err := utilhttp.NewTransport(utilhttp.TransportOptions{Protocol: tt.protocol, MaxIdleConns: 4})
+		require.NoError(t, err)
+		// Trust the test server certificate
+		switch tr := transport.(type) {
+		case *http.Transport:
+			tr.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+		case *http2.Transport:
+			tr.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+		}
+
+		sender := utilhttp.NewHTTPSender(srv.URL, time.Second)
+		sender.SetTransport(transport)
+		var resp struct{ Proto string }
+		require.NoError(t, sender.Get(context.Background(), "/", &resp))
+		assert.Equal(t, tt.want, resp.Proto, "%s over TLS=%v", tt.protocol, tt.tls)
+	}
+}
+
+func TestParseTransportOptions(t *testing.T) {
+	opts, err := utilhttp.ParseTransportOptions(map[string]string{
+		"protocol":           "h2c",
+		"max_idle_conns":     "10",
+		"max_conns_per_host": "20",
+		"idle_conn_timeout":  "45s",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, utilhttp.TransportOptions{Protocol: "h2c", MaxIdleConns: 10, MaxConnsPerHost: 20, IdleConnTimeout: 45 * time.Second}, opts)
+
+	opts, err = utilhttp.ParseTransportOptions(map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, utilhttp.ProtocolAuto, opts.Protocol)
+
+	_, err = utilhttp.ParseTransportOptions(map[string]string{"max_idle_conns": "many"})
+	assert.Error(t, err)
+	_, err = utilhttp.NewTransport(utilhttp.TransportOptions{Protocol: "spdy"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,296 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUpstreamDraining is returned for requests to a drained upstream
+var ErrUpstreamDraining = errors.New("upstream is draining")
+
+// ErrCircuitOpen is returned for requests refused by the circuit breaker of
+// a failing upstream
+var ErrCircuitOpen = errors.New("upstream circuit breaker is open")
+
+// BreakerState is the state of the circuit breaker of an upstream
+type BreakerState string
+
+// Circuit breaker states
+const (
+	BreakerClosed   BreakerState = "closed"    // Requests are sent
+	BreakerOpen     BreakerState = "open"      // Requests are refused until the open duration elapses
+	BreakerHalfOpen BreakerState = "half_open" // A trial request decides whether to close or open again
+)
+
+// BreakerSettings configures the circuit breaker of an upstream
+type BreakerSettings struct {
+	Failures     int           // Consecutive failures opening the breaker, 0 disables it
+	OpenDuration time.Duration // How long requests are refused before a trial
+}
+
+// DefaultBreakerSettings are used for the keys an upstream config leaves out
+var DefaultBreakerSettings = BreakerSettings{Failures: 5, OpenDuration: 30 * time.Second}
+
+// ParseBreakerSettings reads the breaker_failures and breaker_open_duration
+// keys of an upstream config
+func ParseBreakerSettings(cfg map[string]string) (BreakerSettings, error) {
+	settings := DefaultBreakerSettings
+	var err error
+	if v := cfg["breaker_failures"]; v != "" {
+		if settings.Failures, err = strconv.Atoi(v); err != nil || settings.Failures < 0 {
+			return settings, fmt.Errorf("invalid breaker_failures %q", v)
+		}
+	}
+	if v := cfg["breaker_open_duration"]; v != "" {
+		if settings.OpenDuration, err = time.ParseDuration(v); err != nil {
+			return settings, fmt.Errorf("invalid breaker_open_duration: %w", err)
+		}
+	}
+	return settings, nil
+}
+
+// UpstreamStatus describes an upstream service and its recent health
+type UpstreamStatus struct {
+	Name       string    `json:"name"`
+	BaseURL    string    `json:"base_url"`
+	Draining   bool      `json:"draining"`
+	Healthy    bool      `json:"healthy"` // Whether the last request succeeded
+	InFlight   int       `json:"in_flight"`
+	Requests   uint64    `json:"requests"`
+	Errors     uint64    `json:"errors"`
+	LastStatus int       `json:"last_status,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+	LastSeen   time.Time `json:"last_seen,omitempty"`
+
+	Breaker  BreakerState `json:"breaker"`
+	Failures int          `json:"consecutive_failures"`
+
+	breaker  BreakerSettings
+	openedAt time.Time // When the breaker opened
+	trialAt  time.Time // When the trial request of a half open breaker was sent
+}
+
+// BreakerObserver is notified of circuit breaker state changes, such as by
+// the metrics
+type BreakerObserver interface {
+	SetBreakerState(service, state string)
+}
+
+// Upstreams tracks the upstream services of the gateway, their health as
+// seen by the requests sent to them, whether they are drained and their
+// circuit breakers. It is an Observer, forwarding to another observer such
+// as the metrics, which also learns of breaker changes if it is a
+// BreakerObserver.
+type Upstreams struct {
+	next Observer // nil if none
+	now  func() time.Time
+
+	mu       sync.Mutex
+	services map[string]*UpstreamStatus
+}
+
+// NewUpstreams creates an upstream registry forwarding observations to
+// next, which may be nil
+func NewUpstreams(next Observer) *Upstreams {
+	return &Upstreams{
+		next:     next,
+		now:      time.Now,
+		services: make(map[string]*UpstreamStatus),
+	}
+}
+
+// SetClock replaces the clock timing open breakers, for tests
+func (u *Upstreams) SetClock(now func() time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.now = now
+}
+
+// Add registers the upstream service reached at baseURL. Adding a known
+// service updates its base URL and keeps its state. Credentials in baseURL
+// are left out of the status.
+func (u *Upstreams) Add(service, baseURL string) {
+	if parsed, err := url.Parse(baseURL); err == nil && parsed.User != nil {
+		parsed.User = nil
+		baseURL = parsed.String()
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.status(service).BaseURL = baseURL
+}
+
+// status returns the state of service, creating it if needed. The caller
+// holds the lock.
+func (u *Upstreams) status(service string) *UpstreamStatus {
+	st, ok := u.services[service]
+	if !ok {
+		st = &UpstreamStatus{Name: service, Healthy: true, Breaker: BreakerClosed, breaker: DefaultBreakerSettings}
+		u.services[service] = st
+		u.notifyBreaker(st)
+	}
+	return st
+}
+
+// SetBreaker configures the circuit breaker of service, keeping its state
+func (u *Upstreams) SetBreaker(service string, settings BreakerSettings) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.status(service).breaker = settings
+}
+
+// ResetBreaker closes the circuit breaker of service, forgetting its
+// failures. It reports whether the service is known.
+func (u *Upstreams) ResetBreaker(service string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	st, ok := u.services[service]
+	if ok {
+		st.Failures = 0
+		u.setBreaker(st, BreakerClosed)
+	}
+	return ok
+}
+
+// setBreaker moves the breaker of st to state. The caller holds the lock.
+func (u *Upstreams) setBreaker(st *UpstreamStatus, state BreakerState) {
+	st.trialAt = time.Time{}
+	if state == BreakerOpen {
+		st.openedAt = u.now()
+	}
+	if st.Breaker != state {
+		st.Breaker = state
+		u.notifyBreaker(st)
+	}
+}
+
+// notifyBreaker reports the breaker state of st to the next observer. The
+// caller holds the lock.
+func (u *Upstreams) notifyBreaker(st *UpstreamStatus) {
+	if b, ok := u.next.(BreakerObserver); ok {
+		b.SetBreakerState(st.Name, string(st.Breaker))
+	}
+}
+
+// Admit returns an error if a request to service must not be sent: it is
+// drained, or its circuit breaker is open. Once the open duration elapses a
+// single trial request is admitted, and another one if it has not completed
+// after the open duration again.
+func (u *Upstreams) Admit(service string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	st, ok := u.services[service]
+	switch {
+	case !ok:
+		return nil
+	case st.Draining:
+		return ErrUpstreamDraining
+	case st.Breaker == BreakerClosed:
+		return nil
+	}
+
+	now := u.now()
+	if st.Breaker == BreakerOpen {
+		if now.Before(st.openedAt.Add(st.breaker.OpenDuration)) {
+			return ErrCircuitOpen
+		}
+		u.setBreaker(st, BreakerHalfOpen)
+	} else if !st.trialAt.IsZero() && now.Before(st.trialAt.Add(st.breaker.OpenDuration)) {
+		return ErrCircuitOpen
+	}
+	st.trialAt = now
+	return nil
+}
+
+// SetDraining stops or resumes sending requests to service. It reports
+// whether the service is known.
+func (u *Upstreams) SetDraining(service string, draining bool) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	st, ok := u.services[service]
+	if ok {
+		st.Draining = draining
+	}
+	return ok
+}
+
+// Draining reports whether requests to service are refused
+func (u *Upstreams) Draining(service string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	st, ok := u.services[service]
+	return ok && st.Draining
+}
+
+// List returns the state of every upstream, sorted by name
+func (u *Upstreams) List() []UpstreamStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	list := make([]UpstreamStatus, 0, len(u.services))
+	for _, st := range u.services {
+		list = append(list, *st)
+	}
+	slices.SortFunc(list, func(a, b UpstreamStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+// StartUpstream records a request to service, implementing Observer
+func (u *Upstreams) StartUpstream(service, method string) func(status int, err error) {
+	next := func(int, error) {}
+	if u.next != nil {
+		next = u.next.StartUpstream(service, method)
+	}
+
+	u.mu.Lock()
+	u.status(service).InFlight++
+	u.mu.Unlock()
+
+	return func(status int, err error) {
+		next(status, err)
+
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		st := u.status(service)
+		st.InFlight--
+		st.Requests++
+		st.LastStatus = status
+		st.LastSeen = time.Now()
+		st.LastError = ""
+		st.Healthy = err == nil && status < 500
+		if !st.Healthy {
+			st.Errors++
+			if err != nil {
+				st.LastError = err.Error()
+			}
+		}
+		u.recordBreaker(st, status, err)
+	}
+}
+
+// recordBreaker counts the outcome of a request towards the circuit breaker
+// of st. Only server errors and failures to get a response count, and
+// requests completing while the breaker is open do not change it. The
+// caller holds the lock.
+func (u *Upstreams) recordBreaker(st *UpstreamStatus, status int, err error) {
+	failed := status >= 500 || (status == 0 && err != nil && !errors.Is(err, context.Canceled))
+	switch {
+	case st.Breaker == BreakerOpen:
+	case !failed:
+		st.Failures = 0
+		u.setBreaker(st, BreakerClosed)
+	default:
+		st.Failures++
+		if st.Breaker == BreakerHalfOpen || (st.breaker.Failures > 0 && st.Failures >= st.breaker.Failures) {
+			u.setBreaker(st, BreakerOpen)
+		}
+	}
+}
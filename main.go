@@ -1,14 +1,18 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"flag"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"api-gateway/config"
 	_ "api-gateway/docs" // Import swagger docs
+	"api-gateway/internal/logging"
 	"api-gateway/internal/server"
 )
 
@@ -31,35 +35,106 @@ import (
 // @description Type "Bearer" followed by a space and JWT token.
 
 func main() {
+	configPath := flag.String("config", "", "Path to a YAML, TOML or JSON configuration file")
+	flag.Parse()
+
 	// Load configuration
-	cfg, err := config.LoadConfig()
+	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Create the logger injected into every component
+	logger, logCloser, err := logging.New(&cfg.Log)
+	if err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	defer logCloser.Close()
+
 	// Create new server instance
-	srv, err := server.New(cfg)
+	srv, err := server.New(cfg, logger)
 	if err != nil {
-		panic(err)
+		logger.Error("failed to create server", "error", err)
+		os.Exit(1)
 	}
 
 	// Setup graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	// Reload the configuration on SIGHUP and when the config file changes
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	changed := make(chan struct{}, 1)
+	if *configPath != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		err := config.Watch(ctx, *configPath, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+		if err != nil {
+			logger.Error("failed to watch config file", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Resolve secret references again periodically to pick up rotations
+	var refresh <-chan time.Time
+	if cfg.Secrets.RefreshInterval > 0 {
+		ticker := time.NewTicker(cfg.Secrets.RefreshInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
 	// Start the server
-	fmt.Printf("Starting server on port %s...\n", cfg.Server.Port)
 	if err := srv.Start(); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+		logger.Error("error starting server", "error", err)
+		srv.Stop()
+		os.Exit(1)
 	}
-	// Wait for interrupt signal
-	<-quit
-	fmt.Println("\nShutdown signal received...")
+	// Wait for interrupt signal, reloading the configuration meanwhile
+	exitCode := 0
+	for waiting := true; waiting; {
+		select {
+		case err := <-srv.Err():
+			logger.Error("server stopped serving", "error", err)
+			exitCode = 1
+			waiting = false
+		case <-hup:
+			reload(srv, *configPath, logger)
+		case <-changed:
+			reload(srv, *configPath, logger)
+		case <-refresh:
+			reload(srv, *configPath, logger)
+		case <-quit:
+			waiting = false
+		}
+	}
+	logger.Info("shutting down")
 
 	// Gracefully shutdown the server
 	if err := srv.Stop(); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		logger.Error("server forced to shutdown", "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("server exited properly")
+	if exitCode != 0 {
+		os.Exit(exitCode)
 	}
+}
 
-	fmt.Println("Server exited properly")
+// reload loads and applies the configuration, keeping the current one when
+// the new one is invalid
+func reload(srv *server.Server, configPath string, logger *slog.Logger) {
+	cfg, err := config.LoadConfig(configPath)
+	if err == nil {
+		err = srv.Reload(cfg)
+	}
+	if err != nil {
+		logger.Error("configuration reload rejected, keeping the current configuration", "error", err)
+	}
 }